@@ -2,55 +2,97 @@ package app
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
-	"time"
+	"strings"
 
+	"shorty/app/routes"
 	"shorty/config"
 	"shorty/pkg"
+	"shorty/types"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/keyauth"
 	"github.com/rs/zerolog/log"
-	"github.com/zeebo/blake3"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func verifyKey() func(c fiber.Ctx) error {
 	return keyauth.New(keyauth.Config{
 		Validator: func(c fiber.Ctx, key string) (bool, error) {
-			if err := verifyAPIKey(c.Context(), key); err != nil {
-				log.Error().Caller().Err(err).Str("path", c.Path()).Str("hash", key).Send()
+			caller, err := verifyAPIKey(c.Context(), key)
+			if err != nil {
+				log.Error().Caller().Err(err).Str("path", c.Path()).Str("token", tokenID(key)).Send()
 				return false, keyauth.ErrMissingOrMalformedAPIKey
 			}
 
+			routes.SetCaller(c, caller)
+
 			return true, nil
 		},
 		ErrorHandler: errHandler,
 	})
 }
 
-func verifyAPIKey(ctx context.Context, hashed string) error {
-	if config.Use.App.Token != "" && hashed == config.Use.App.Token {
-		return nil
+// requireRole rejects callers whose role is below min, it must run after the caller is set
+func requireRole(min types.Role) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		caller := routes.GetCaller(c)
+		if !caller.Role.Can(min) {
+			return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("%s role required", min))
+		}
+
+		return c.Next()
+	}
+}
+
+// requireScope rejects API tokens that weren't granted scope, sessions are not scoped
+func requireScope(scope string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if !routes.GetCaller(c).HasScope(scope) {
+			return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("token lacks %s scope", scope))
+		}
+
+		return c.Next()
 	}
+}
 
-	if _, err := pkg.RedisAuth.Get(ctx, hashed); err == nil {
-		return fmt.Errorf("%s already used", hashed)
+func verifyAPIKey(ctx context.Context, key string) (types.Caller, error) {
+	// The static token is the deployment's master key
+	if config.Use.App.Token != "" && subtle.ConstantTimeCompare([]byte(key), []byte(config.Use.App.Token)) == 1 {
+		return types.Caller{
+			Name:   "api",
+			Method: "master_token",
+			Role:   types.RoleAdmin,
+		}, nil
 	}
 
-	h := []byte(hashed)
-	i := []byte(config.Use.App.Key)
+	token, err := pkg.RedisAuth.VerifyToken(ctx, key)
+	if err != nil {
+		return types.Caller{}, err
+	}
 
-	k := blake3.New()
-	if _, err := k.Write(i); err != nil {
-		log.Error().Caller().Err(err).Send()
-		return err
+	// The token acts with the owner's current role, so a demotion applies to it at once, but never
+	// above the role its creator had
+	role := routes.ResolveRole(token.Owner, token.Groups)
+	if !token.Role.Can(role) {
+		role = token.Role
 	}
-	hash := k.Sum(nil)
 
-	if err := bcrypt.CompareHashAndPassword(h, hash); err != nil {
-		return err
+	return types.Caller{
+		Name:   token.Owner,
+		Method: "token:" + token.Name,
+		Role:   role,
+		Scopes: token.Scopes,
+	}, nil
+}
+
+// tokenID keeps only the public part of a token so secrets never end up in logs
+func tokenID(key string) string {
+	if _, rest, ok := strings.Cut(key, "_"); ok {
+		if id, _, ok := strings.Cut(rest, "_"); ok {
+			return id
+		}
 	}
 
-	return pkg.RedisAuth.Set(ctx, hashed, hash, 10*time.Minute)
+	return "-"
 }
@@ -4,6 +4,7 @@ import (
 	"shorty/app/routes"
 	"shorty/app/routes/ui"
 	"shorty/config"
+	"shorty/types"
 	"strings"
 
 	"github.com/gofiber/fiber/v3"
@@ -38,26 +39,75 @@ func router(app *fiber.App) {
 	app.Get("/auth/check", ui.CheckSession)
 	app.Get("/login", func(ctx fiber.Ctx) error { return ctx.Render("login", nil) })
 	app.Get("/logout", ui.Logout)
-	app.Post("/shorty", ui.Create)
-	app.Post("/check-filename", ui.CheckFilename)
-	app.Get("/events", ui.SSE) // SSE
-	app.Patch("/:oldName/:newName", ui.Change)
-	app.Delete("/:shorty", ui.Delete)
+
+	// Fiber takes the handler first and runs it last, after the role and scope checks that follow it
+	viewer := requireRole(types.RoleViewer)
+	editor := requireRole(types.RoleEditor)
+	admin := requireRole(types.RoleAdmin)
+
+	// API group, before the UI routes below whose params would swallow /v1/...
+	v1 := app.Group("/v1", verifyKey())
+	v1.Post("/shorty", routes.Shorten, editor, requireScope(types.ScopeCreate))            // Create short url
+	v1.Post("/shorty/batch", routes.BatchShorten, editor, requireScope(types.ScopeCreate)) // Create many short urls
+	v1.Delete("/batch", routes.BatchDelete, editor, requireScope(types.ScopeDelete))       // Delete many urls
+
+	// Blocklist of malicious destinations, before /:shorty would take "blocklist" for a shorty
+	v1.Get("/blocklist", routes.Blocklist, admin, requireScope(types.ScopeList))                 // Loaded blocklist and managed entries
+	v1.Post("/blocklist", routes.BlockEntry, admin, requireScope(types.ScopeCreate))             // Block a domain, url or pattern
+	v1.Delete("/blocklist", routes.UnblockEntry, admin, requireScope(types.ScopeDelete))         // Unblock a managed entry
+	v1.Post("/blocklist/reload", routes.ReloadBlocklist, admin, requireScope(types.ScopeCreate)) // Reload blocklist files
+	v1.Get("/blocklist/check", routes.CheckBlocklist, admin, requireScope(types.ScopeList))      // Check a url against the blocklist
+
+	// Literal paths go before /:shorty/... so a tag named "history" or "stats" isn't taken for a shorty
+	v1.Get("/tags", routes.ListTags, viewer, requireScope(types.ScopeList))                // Tags with link counts
+	v1.Get("/tags/:tag", routes.TaggedLinks, viewer, requireScope(types.ScopeList))        // Urls in a tag
+	v1.Post("/tags/bulk", routes.BulkTag, editor, requireScope(types.ScopeCreate))         // Tag or untag many urls
+	v1.Delete("/tags/:tag", routes.DeleteTag, editor, requireScope(types.ScopeDelete))     // Delete every url in a tag
+	v1.Delete("/:shorty", routes.Delete, editor, requireScope(types.ScopeDelete))          // Delete url
+	v1.Patch("/:oldName/:newName", routes.Change, editor, requireScope(types.ScopeCreate)) // Rename url
+	v1.Patch("/:shorty", routes.Update, editor, requireScope(types.ScopeCreate))           // Edit url
+	v1.Get("/:shorty/history", routes.History, viewer, requireScope(types.ScopeList))      // Previous destinations
+	v1.Post("/:shorty/revert", routes.Revert, editor, requireScope(types.ScopeCreate))     // Back to a previous destination
+	v1.Put("/:shorty/ttl", routes.SetTTL, editor, requireScope(types.ScopeCreate))         // Extend, shorten or remove expiry
+	v1.Get("/list", routes.List, viewer, requireScope(types.ScopeList))                    // List all urls
+	v1.Get("/search", routes.Search, viewer, requireScope(types.ScopeList))                // Search urls
+	v1.Get("/export", routes.Export, viewer, requireScope(types.ScopeList))                // Export urls as ndjson or csv
+	v1.Post("/import", routes.Import, editor, requireScope(types.ScopeCreate))             // Import urls from ndjson or csv
+	v1.Get("/:shorty/stats", routes.Stats, viewer, requireScope(types.ScopeList))          // Click stats of url
+	v1.Get("/tokens", routes.ListTokens, editor)                                           // List API tokens
+	v1.Post("/tokens", routes.CreateToken, editor)                                         // Create API token
+	v1.Delete("/tokens/:id", routes.RevokeToken, editor)                                   // Revoke API token
+	v1.Get("/audit", routes.Audit, admin, requireScope(types.ScopeList))                   // Query audit log
 
 	if config.Use.S3.Enable {
-		app.Post("/upload", ui.Upload)
+		v1.Post("/upload", routes.Upload, admin, requireScope(types.ScopeUpload)) // Upload file
 	}
 
+	// UI actions of the logged in user
+	app.Post("/shorty", ui.Create, ui.Session, editor)
+	app.Post("/check-filename", ui.CheckFilename, ui.Session, admin)
+	app.Get("/events", ui.SSE, ui.Session, viewer) // SSE
+	app.Get("/search", routes.Search, ui.Session, viewer)
+	app.Patch("/:oldName/:newName", ui.Change, ui.Session, editor)
+	app.Delete("/:shorty", ui.Delete, ui.Session, editor)
+
+	if config.Use.S3.Enable {
+		app.Post("/upload", ui.Upload, ui.Session, admin)
+	}
+
+	// API tokens of the logged in user
+	app.Get("/tokens", routes.ListTokens, ui.Session, editor)
+	app.Post("/tokens", routes.CreateToken, ui.Session, editor)
+	app.Delete("/tokens/:id", routes.RevokeToken, ui.Session, editor)
+	app.Get("/audit", routes.Audit, ui.Session, admin)
+
 	// wasm
 	// app.Get("/web/*", static.New("web", static.Config{Compress: true}))
 
 	// Get real url
 	app.Get("/:shorty", routes.Get)
+	app.Post("/:shorty", routes.Unlock) // Password protected url
 
-	// API group
-	v1 := app.Group("/v1", verifyKey())
-	v1.Post("/shorty", routes.Shorten)             // Create short url
-	v1.Delete("/:shorty", routes.Delete)           // Delete url
-	v1.Patch("/:oldName/:newName?", routes.Change) // Rename url
-	v1.Get("/list", routes.List)                   // List all urls
+	// Custom shorty can't take over any path above
+	routes.ReserveRoutes(app)
 }
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"shorty/config"
+	"shorty/utils"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+var (
+	aliasPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+	// reserved holds the first path segment of every registered route, plus paths served
+	// by the static handlers that never show up as routes
+	reserved = map[string]struct{}{
+		"_app":        {},
+		"favicon.ico": {},
+		"favicon.png": {},
+		"robots.txt":  {},
+	}
+)
+
+// ReserveRoutes must run once every route is registered
+func ReserveRoutes(app *fiber.App) {
+	for _, route := range app.GetRoutes(true) {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(route.Path, "/"), "/")
+		if segment == "" || strings.ContainsAny(segment[:1], ":*+") {
+			continue
+		}
+
+		reserved[strings.ToLower(segment)] = struct{}{}
+	}
+}
+
+func IsReserved(shorty string) bool {
+	_, ok := reserved[strings.ToLower(shorty)]
+	return ok
+}
+
+// validateAlias normalizes a custom shorty and rejects anything the /:shorty route can't serve
+func validateAlias(alias string) (string, error) {
+	normalized := utils.NormalizeAlias(alias)
+	if normalized == "" {
+		return "", fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("shorty %q has no usable characters", alias))
+	}
+
+	minLength, maxLength := config.Use.Alias.MinLength, config.Use.Alias.MaxLength
+	if len(normalized) < minLength || len(normalized) > maxLength {
+		return "", fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("shorty %q must be %d to %d characters long", normalized, minLength, maxLength))
+	}
+
+	if !aliasPattern.MatchString(normalized) {
+		return "", fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("shorty %q may only contain a-z, 0-9, - and _", normalized))
+	}
+
+	if IsReserved(normalized) {
+		return "", fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("shorty %q is reserved", normalized))
+	}
+
+	return normalized, nil
+}
@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"time"
+
+	"shorty/pkg"
+	"shorty/types"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// audit records a mutating operation done by the current caller
+func audit(ctx fiber.Ctx, action, shorty, oldValue, newValue string) {
+	caller := GetCaller(ctx)
+	pkg.Record(ctx.Context(), types.AuditEntry{
+		Actor:  caller.Name,
+		Method: caller.Method,
+		Action: action,
+		Shorty: shorty,
+		Old:    oldValue,
+		New:    newValue,
+		IP:     ctx.IP(),
+	})
+}
+
+func Audit(ctx fiber.Ctx) error {
+	if pkg.Audit == nil {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "audit log is disabled")
+	}
+
+	filter := types.AuditFilter{
+		Actor:  ctx.Query("actor"),
+		Action: ctx.Query("action"),
+		Shorty: ctx.Query("shorty"),
+		Limit:  fiber.Query(ctx, "limit", 100),
+	}
+
+	for param, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value := ctx.Query(param)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid "+param+", expected RFC3339: "+err.Error())
+		}
+		*dst = t
+	}
+
+	entries, err := pkg.Audit.Query(ctx.Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	if entries == nil {
+		entries = []types.AuditEntry{}
+	}
+
+	return ctx.JSON(entries)
+}
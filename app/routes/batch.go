@@ -0,0 +1,180 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"shorty/config"
+	"shorty/pkg"
+	"shorty/types"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// BatchShorten creates many links at once, every item gets its own status and a bad item doesn't fail the rest
+func BatchShorten(ctx fiber.Ctx) error {
+	var items []types.Shorten
+	if err := ctx.Bind().Body(&items); err != nil {
+		return err
+	}
+
+	if err := checkBatchSize(len(items)); err != nil {
+		return err
+	}
+
+	// Workers only get the request context and the owner, fiber.Ctx isn't safe to share between goroutines
+	c, owner := ctx.Context(), GetCaller(ctx).Name
+	results := make([]types.BulkResult, len(items))
+	links := make([]types.Link, len(items))
+	ttls := make([]time.Duration, len(items))
+	entries := make([]pkg.Entry, len(items))
+	regular := make([]bool, len(items))
+
+	// Generated names may take a round trip to the store each, so items are prepared concurrently
+	inParallel(len(items), func(i int) {
+		item := &items[i]
+
+		var err error
+		if links[i], ttls[i], err = prepareShorten(item, owner); err != nil {
+			results[i] = bulkResult(item.Shorty, err)
+			return
+		}
+
+		name := item.Shorty
+		if name == "" {
+			if name, err = pkg.GenerateShorty(c, item.Generator, item.Length, 0); err != nil {
+				results[i] = bulkResult("", err)
+				return
+			}
+		}
+
+		// Links with their own S3 credentials, and generated names that hit a route, take the regular create
+		if (item.S3Key.Access != "" && item.S3Key.Secret != "") || IsReserved(name) {
+			regular[i] = true
+			return
+		}
+
+		entries[i] = pkg.Entry{Key: name, Link: links[i], TTL: ttls[i]}
+	})
+
+	for i, item := range items {
+		if regular[i] {
+			name, err := createLink(ctx, item.Shorty, item.Generator, item.Length, links[i], item.S3Key, ttls[i])
+			items[i].Shorty, results[i] = name, bulkResult(name, err)
+		}
+	}
+
+	// Write everything that passed in one go
+	var pending []int
+	var batch []pkg.Entry
+	for i, entry := range entries {
+		if entry.Key != "" {
+			pending = append(pending, i)
+			batch = append(batch, entry)
+		}
+	}
+
+	errs := pkg.Store.SetMany(c, batch)
+	for n, i := range pending {
+		item, name, err := &items[i], batch[n].Key, errs[n]
+
+		// A generated name that is taken gets the retries of a single create
+		if item.Shorty == "" && errors.Is(err, pkg.ErrAlreadyExists) {
+			name, err = createLink(ctx, "", item.Generator, item.Length, links[i], types.S3Credentials{}, ttls[i])
+		} else if err == nil {
+			linkCreated(c, name, links[i])
+		}
+
+		item.Shorty = name
+		results[i] = bulkResult(name, err)
+	}
+
+	for i, item := range items {
+		if results[i].Status == fiber.StatusOK {
+			results[i].Url = fmt.Sprintf("%s/%s", ctx.BaseURL(), item.Shorty)
+			if !item.SkipCheck {
+				pkg.ValidateAsync(item.Shorty, item.Url)
+			}
+			audit(ctx, types.ActionCreate, item.Shorty, "", item.Url)
+		}
+	}
+
+	return ctx.JSON(results)
+}
+
+// BatchDelete deletes many links at once, skipping the ones the caller may not manage
+func BatchDelete(ctx fiber.Ctx) error {
+	var shorties []string
+	if err := ctx.Bind().Body(&shorties); err != nil {
+		return err
+	}
+
+	if err := checkBatchSize(len(shorties)); err != nil {
+		return err
+	}
+
+	c, caller := ctx.Context(), GetCaller(ctx)
+	results := make([]types.BulkResult, len(shorties))
+	links := make([]types.Link, len(shorties))
+
+	inParallel(len(shorties), func(i int) {
+		link, err := pkg.Store.Get(c, shorties[i])
+		if err != nil {
+			err = fiber.NewError(fiber.StatusNotFound, err.Error())
+		} else if !canManage(caller, link) {
+			err = fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("%s is not yours", shorties[i]))
+		}
+
+		links[i] = link
+		results[i] = bulkResult(shorties[i], err)
+	})
+
+	var keys []string
+	for i, result := range results {
+		if result.Status == fiber.StatusOK {
+			keys = append(keys, shorties[i])
+		}
+	}
+
+	if err := pkg.Store.DelMany(c, keys); err != nil {
+		return err
+	}
+
+	for i, result := range results {
+		if result.Status == fiber.StatusOK {
+			results[i] = bulkResult(shorties[i], purgeLink(ctx, shorties[i], links[i]))
+		}
+	}
+
+	return ctx.JSON(results)
+}
+
+func checkBatchSize(n int) error {
+	if n == 0 || n > config.Use.Batch.MaxItems {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("a batch takes 1 to %d items", config.Use.Batch.MaxItems))
+	}
+
+	return nil
+}
+
+// inParallel calls fn for every index on at most batch.workers goroutines
+func inParallel(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(config.Use.Batch.Workers, 1))
+
+	for i := range n {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}()
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"errors"
+
+	"shorty/config"
+	"shorty/pkg"
+	"shorty/types"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Blocklist describes the loaded blocklist and lists the entries managed here
+func Blocklist(ctx fiber.Ctx) error {
+	if pkg.Blocklist == nil {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "blocklist is not loaded")
+	}
+
+	return ctx.JSON(pkg.Blocklist.Info())
+}
+
+// BlockEntry adds a domain, url or /regex/ to the local blocklist, existing links to it stop redirecting
+func BlockEntry(ctx fiber.Ctx) error {
+	var body types.BlocklistEntry
+	if err := ctx.Bind().Body(&body); err != nil {
+		return err
+	}
+
+	if pkg.Blocklist == nil {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "blocklist is not loaded")
+	}
+
+	entry, err := pkg.Blocklist.Add(body.Entry)
+	if errors.Is(err, pkg.ErrInvalidEntry) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	audit(ctx, types.ActionBlock, "", "", entry)
+
+	return ctx.Status(fiber.StatusCreated).JSON(types.BlocklistEntry{Entry: entry})
+}
+
+// UnblockEntry removes an entry of the local blocklist, entries of the configured files stay
+func UnblockEntry(ctx fiber.Ctx) error {
+	var body types.BlocklistEntry
+	if err := ctx.Bind().Body(&body); err != nil {
+		return err
+	}
+
+	if pkg.Blocklist == nil {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "blocklist is not loaded")
+	}
+
+	err := pkg.Blocklist.Remove(body.Entry)
+	if errors.Is(err, pkg.ErrNotListed) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	audit(ctx, types.ActionUnblock, "", body.Entry, "")
+
+	return ctx.JSON(types.Response{
+		Error:   false,
+		Message: body.Entry + " unblocked",
+	})
+}
+
+// ReloadBlocklist reads the blocklist files again without waiting for the reloader
+func ReloadBlocklist(ctx fiber.Ctx) error {
+	if pkg.Blocklist == nil {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "blocklist is not loaded")
+	}
+
+	if err := pkg.Blocklist.Reload(); err != nil {
+		return err
+	}
+
+	return ctx.JSON(pkg.Blocklist.Info())
+}
+
+// CheckBlocklist tells whether a url is blocked and by which entry
+func CheckBlocklist(ctx fiber.Ctx) error {
+	target := ctx.Query("url")
+	if target == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "url is required")
+	}
+
+	entry, blocked := pkg.Blocked(target)
+	return ctx.JSON(types.BlocklistMatch{Url: target, Blocked: blocked, Entry: entry})
+}
+
+// renderBlocked warns visitors of a link whose destination got blocklisted instead of sending them there
+func renderBlocked(ctx fiber.Ctx, shorturl string) error {
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+
+	return ctx.Status(fiber.StatusForbidden).Render(config.Use.Blocklist.Template, fiber.Map{
+		"Shorty": shorturl,
+	})
+}
@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"slices"
+
+	"shorty/config"
+	"shorty/types"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const callerKey = "caller"
+
+func SetCaller(ctx fiber.Ctx, caller types.Caller) {
+	ctx.Locals(callerKey, caller)
+}
+
+// GetCaller returns the authenticated caller, an anonymous caller owns nothing
+func GetCaller(ctx fiber.Ctx) types.Caller {
+	caller, _ := ctx.Locals(callerKey).(types.Caller)
+	return caller
+}
+
+// ResolveRole picks the highest role granted to the user by name or by any of its groups
+func ResolveRole(name string, groups []string) types.Role {
+	roles := &config.Use.Roles
+	matches := func(users, userGroups []string) bool {
+		if slices.Contains(users, name) {
+			return true
+		}
+
+		for _, group := range groups {
+			if slices.Contains(userGroups, group) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	switch {
+	case matches(roles.Admins, roles.Groups.Admins):
+		return types.RoleAdmin
+	case matches(roles.Editors, roles.Groups.Editors):
+		return types.RoleEditor
+	case matches(roles.Viewers, roles.Groups.Viewers):
+		return types.RoleViewer
+	default:
+		return types.Role(roles.Default)
+	}
+}
+
+// canManage reports whether the caller may rename or delete a link
+func canManage(caller types.Caller, link types.Link) bool {
+	if caller.IsAdmin() {
+		return true
+	}
+
+	return caller.Role.Can(types.RoleEditor) && link.Owner != "" && link.Owner == caller.Name
+}
+
+// canListAll reports whether the caller may see the links of everyone, by default only admins may
+func canListAll(caller types.Caller) bool {
+	return caller.Role.Can(types.Role(config.Use.Roles.All))
+}
+
+// ScopeToCaller keeps only the caller's own links unless all links are asked for and allowed,
+// destinations of protected links are hidden from whoever can't manage them
+func ScopeToCaller(caller types.Caller, all bool, list []types.Shorten) []types.Shorten {
+	all = all && canListAll(caller)
+
+	scoped := make([]types.Shorten, 0, len(list))
+	for _, item := range list {
+		if item, ok := inScope(caller, all, item); ok {
+			scoped = append(scoped, item)
+		}
+	}
+
+	return scoped
+}
+
+// inScope is ScopeToCaller for a single link, all must already be checked against canListAll
+func inScope(caller types.Caller, all bool, item types.Shorten) (types.Shorten, bool) {
+	if !all && (item.Owner == "" || item.Owner != caller.Name) {
+		return item, false
+	}
+
+	if item.Protected && !canManage(caller, types.Link{Owner: item.Owner}) {
+		item.Url, item.File = "", ""
+	}
+
+	return item, true
+}
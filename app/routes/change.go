@@ -2,35 +2,28 @@ package routes
 
 import (
 	"fmt"
+
 	"shorty/pkg"
 	"shorty/types"
 
 	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
 )
 
 func Change(ctx fiber.Ctx) error {
 	oldName := ctx.Params("oldName")
-	urlValue, err := pkg.Redis.Get(ctx.Context(), oldName)
+	link, err := pkg.Store.Get(ctx.Context(), oldName)
 	if err != nil {
 		return err
 	}
 
-	newName := ctx.Params("newName")
-
-	var body types.Shorten
-	if newName == "" {
-		if err := ctx.Bind().Body(&body); err != nil {
-			return err
-		}
-
-		if body.Shorty == "" {
-			return ctx.JSON(types.Response{
-				Error:   true,
-				Message: "new shorty cannot be empty",
-			})
-		}
+	if !canManage(GetCaller(ctx), link) {
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("%s is not yours", oldName))
+	}
 
-		newName = body.Shorty
+	newName := ctx.Params("newName")
+	if newName, err = validateAlias(newName); err != nil {
+		return err
 	}
 
 	if newName == oldName {
@@ -40,11 +33,7 @@ func Change(ctx fiber.Ctx) error {
 		})
 	}
 
-	if err := pkg.Redis.Set(ctx.Context(), newName, urlValue, body.Expired); err != nil {
-		return err
-	}
-
-	if err := pkg.Redis.Del(ctx.Context(), oldName); err != nil {
+	if err := rename(ctx, oldName, newName); err != nil {
 		return err
 	}
 
@@ -53,3 +42,24 @@ func Change(ctx fiber.Ctx) error {
 		Message: fmt.Sprintf("%s changed to %s", oldName, newName),
 	})
 }
+
+// rename moves a validated shorty along with its stats
+func rename(ctx fiber.Ctx, oldName, newName string) error {
+	// Rename keeps TTL and sidecar data and never overwrites an existing shorty
+	if err := pkg.Store.Rename(ctx.Context(), oldName, newName); err != nil {
+		return err
+	}
+
+	if err := pkg.Analytics.Rename(ctx.Context(), oldName, newName); err != nil {
+		log.Warn().Err(err).Str("shorty", oldName).Msg("failed to move stats")
+	}
+
+	pkg.UnindexLink(ctx.Context(), oldName)
+	if link, err := pkg.Store.Get(ctx.Context(), newName); err == nil {
+		pkg.IndexLink(ctx.Context(), newName, link)
+	}
+
+	audit(ctx, types.ActionRename, newName, oldName, newName)
+
+	return nil
+}
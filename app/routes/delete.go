@@ -2,7 +2,6 @@ package routes
 
 import (
 	"fmt"
-	"strings"
 
 	"shorty/config"
 	"shorty/pkg"
@@ -10,30 +9,23 @@ import (
 	"shorty/utils"
 
 	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
 )
 
 func Delete(ctx fiber.Ctx) error {
 	shorturl := ctx.Params("shorty")
 
-	key, err := pkg.Redis.Get(ctx.Context(), shorturl)
+	link, err := pkg.Store.Get(ctx.Context(), shorturl)
 	if err != nil {
 		return err
 	}
 
-	if err := pkg.Redis.Del(ctx.Context(), shorturl); err != nil {
-		return err
+	if !canManage(GetCaller(ctx), link) {
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("%s is not yours", shorturl))
 	}
 
-	if config.Use.S3.Enable {
-		prefix := fmt.Sprintf("https://%s/%s/", config.Use.S3.Endpoint, config.Use.S3.Bucket)
-		if strings.HasPrefix(key, prefix) {
-			getObjectName := strings.TrimPrefix(key, prefix)
-			objectName := strings.SplitN(getObjectName, "?", 2)[0]
-
-			if err := utils.Storage.Delete(objectName); err != nil {
-				return err
-			}
-		}
+	if err := deleteLink(ctx, shorturl, link); err != nil {
+		return err
 	}
 
 	return ctx.JSON(types.Response{
@@ -41,3 +33,31 @@ func Delete(ctx fiber.Ctx) error {
 		Message: fmt.Sprintf("%s deleted", shorturl),
 	})
 }
+
+// deleteLink removes a link the caller may manage, along with its stats and uploaded file
+func deleteLink(ctx fiber.Ctx, shorturl string, link types.Link) error {
+	if err := pkg.Store.Del(ctx.Context(), shorturl); err != nil {
+		return err
+	}
+
+	return purgeLink(ctx, shorturl, link)
+}
+
+// purgeLink cleans up after a link left the store: index, stats and uploaded file
+func purgeLink(ctx fiber.Ctx, shorturl string, link types.Link) error {
+	pkg.UnindexLink(ctx.Context(), shorturl)
+
+	if err := pkg.Analytics.Purge(ctx.Context(), shorturl); err != nil {
+		log.Warn().Err(err).Str("shorty", shorturl).Msg("failed to purge stats")
+	}
+
+	if config.Use.S3.Enable && link.Kind == types.KindFile && link.Object != "" {
+		if err := utils.Storage.Delete(link.Object); err != nil {
+			return err
+		}
+	}
+
+	audit(ctx, types.ActionDelete, shorturl, link.Url, "")
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"shorty/pkg"
+	"shorty/types"
+	"shorty/utils"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// exportColumns is the CSV header of /v1/export, /v1/import reads the same columns
+var exportColumns = []string{
+	"shorty", "url", "kind", "object", "owner", "tags", "notes", "redirect", "max_clicks",
+	"not_before", "not_after", "expires_at", "permanent", "protected", "has_credentials", "created_at",
+}
+
+// csvTagSeparator joins tags in a single CSV cell
+const csvTagSeparator = "|"
+
+// Export streams links as NDJSON (default) or CSV
+func Export(ctx fiber.Ctx) error {
+	format := ctx.Query("format", "ndjson")
+	if format != "ndjson" && format != "csv" {
+		return fiber.NewError(fiber.StatusBadRequest, "format must be ndjson or csv")
+	}
+
+	caller := GetCaller(ctx)
+	all := fiber.Query[bool](ctx, "all") && canListAll(caller)
+
+	filename := fmt.Sprintf("shorty-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	ctx.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+
+	asCSV := format == "csv"
+	if asCSV {
+		ctx.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	} else {
+		ctx.Set(fiber.HeaderContentType, "application/x-ndjson")
+	}
+
+	// Records are written as the store walks its links, so the export is never held in memory.
+	// The request context is gone once the handler returns, the writer runs after that.
+	return ctx.SendStreamWriter(func(w *bufio.Writer) {
+		var cw *csv.Writer
+		if asCSV {
+			cw = csv.NewWriter(w)
+			defer cw.Flush()
+
+			if err := cw.Write(exportColumns); err != nil {
+				return
+			}
+		}
+
+		err := pkg.Store.Each(context.Background(), func(item types.Shorten) bool {
+			item, ok := inScope(caller, all, item)
+			if !ok {
+				return true
+			}
+
+			record := exportRecord(item)
+
+			var err error
+			if cw != nil {
+				err = cw.Write(csvRow(record))
+			} else {
+				_, err = w.Write(append(utils.ToJSON(record), '\n'))
+			}
+
+			if err != nil {
+				log.Error().Caller().Err(err).Msg("failed to write export")
+				return false
+			}
+
+			return true
+		})
+		if err != nil {
+			log.Error().Caller().Err(err).Msg("failed to read links for export")
+		}
+	})
+}
+
+// exportRecord is a listed link as written to an export
+func exportRecord(item types.Shorten) types.ExportRecord {
+	return types.ExportRecord{
+		Shorty:         item.Shorty,
+		Url:            item.Url,
+		Kind:           item.Kind,
+		Object:         item.File,
+		Owner:          item.Owner,
+		Tags:           item.Tags,
+		Notes:          item.Notes,
+		Redirect:       item.Redirect,
+		MaxClicks:      item.MaxClicks,
+		NotBefore:      item.NotBefore,
+		NotAfter:       item.NotAfter,
+		ExpiresAt:      item.ExpiresAt,
+		Permanent:      item.Permanent,
+		Protected:      item.Protected,
+		HasCredentials: item.HasS3Key,
+		CreatedAt:      item.CreatedAt,
+	}
+}
+
+func csvRow(r types.ExportRecord) []string {
+	return []string{
+		r.Shorty, r.Url, r.Kind, r.Object, r.Owner, strings.Join(r.Tags, csvTagSeparator), r.Notes, r.Redirect,
+		formatInt(r.MaxClicks), formatTime(r.NotBefore), formatTime(r.NotAfter), formatTime(r.ExpiresAt),
+		formatBool(r.Permanent), formatBool(r.Protected), formatBool(r.HasCredentials), formatTime(r.CreatedAt),
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatInt(n int64) string {
+	if n == 0 {
+		return ""
+	}
+
+	return strconv.FormatInt(n, 10)
+}
+
+func formatBool(b bool) string {
+	if !b {
+		return ""
+	}
+
+	return "true"
+}
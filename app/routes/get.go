@@ -1,12 +1,21 @@
 package routes
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"path"
+	"strconv"
 	"strings"
 	"time"
 
 	"shorty/config"
 	"shorty/pkg"
+	"shorty/types"
+	"shorty/utils"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/minio/minio-go/v7"
@@ -18,61 +27,279 @@ func Get(ctx fiber.Ctx) error {
 	shorturl := ctx.Params("shorty")
 
 	// Get the short URL data
-	realurl, err := pkg.Redis.Get(ctx.Context(), shorturl)
+	link, err := pkg.Store.Get(ctx.Context(), shorturl)
 	if err != nil {
 		return ctx.SendStatus(fiber.StatusNotFound)
 	}
 
+	if state := link.State(time.Now()); state != types.StateActive {
+		return renderUnavailable(ctx, shorturl, link, state)
+	}
+
+	// Destinations blocked after the link was made stop working right away
+	if _, blocked := pkg.Blocked(link.Url); blocked {
+		return renderBlocked(ctx, shorturl)
+	}
+
+	// Protected links only redirect after a correct POST to Unlock
+	if link.Password != "" {
+		return renderPasswordForm(ctx, shorturl, "")
+	}
+
+	return redirect(ctx, shorturl, link)
+}
+
+// renderUnavailable answers for links outside their activation window
+func renderUnavailable(ctx fiber.Ctx, shorturl string, link types.Link, state string) error {
+	if state == types.StateEnded {
+		return ctx.SendStatus(fiber.StatusGone)
+	}
+
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	ctx.Set(fiber.HeaderRetryAfter, link.NotBefore.UTC().Format(http.TimeFormat))
+
+	return ctx.Status(fiber.StatusServiceUnavailable).Render(config.Use.Schedule.PendingTemplate, fiber.Map{
+		"Shorty":    shorturl,
+		"Message":   config.Use.Schedule.PendingMessage,
+		"NotBefore": link.NotBefore,
+	})
+}
+
+// forgetLink drops the index entry and stats of a link its last click removed, as Delete does
+func forgetLink(ctx fiber.Ctx, shorturl string) {
+	pkg.UnindexLink(ctx.Context(), shorturl)
+
+	if err := pkg.Analytics.Purge(ctx.Context(), shorturl); err != nil {
+		log.Warn().Err(err).Str("shorty", shorturl).Msg("failed to purge stats")
+	}
+}
+
+// redirect sends the client to the link target, presigning S3 URLs that carry credentials
+func redirect(ctx fiber.Ctx, shorturl string, link types.Link) error {
+	realurl := link.Url
+
+	// Limited links are counted before anything is served, the last click removes the link
+	left := int64(-1)
+	if link.MaxClicks > 0 {
+		var err error
+		if left, err = pkg.Store.Consume(ctx.Context(), shorturl); err != nil {
+			if errors.Is(err, pkg.ErrNoClicksLeft) {
+				forgetLink(ctx, shorturl)
+			}
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+	}
+
+	if left == 0 {
+		forgetLink(ctx, shorturl)
+	} else {
+		recordClick(ctx, shorturl, link.ExpiresAt)
+	}
+
+	// A presigned URL would outlive the click limit, so limited uploads are streamed instead
+	if left >= 0 && config.Use.S3.Enable && link.Kind == types.KindFile && link.Object != "" {
+		return streamObject(ctx, link.Object, left == 0)
+	}
+
+	// The key is already gone when this was its last click
+	ttl, err := pkg.Store.TTL(ctx.Context(), shorturl)
+	if err != nil {
+		ttl = 0
+	}
+
+	target, presigned := realurl, time.Duration(0)
+
+	// Uploads are signed again on every click, the stored URL may be older than the link
+	if config.Use.S3.Enable && link.Kind == types.KindFile && link.Object != "" {
+		if presignedURL, expiry, err := presignObject(ctx, link.Object, ttl); err == nil {
+			target, presigned = presignedURL, expiry
+		} else {
+			log.Error().Err(err).Str("file", link.Object).Msg("failed to presign upload")
+		}
+	}
+
 	// Check if this is an S3 URL with credentials
-	s3Creds, err := pkg.Redis.GetS3Credentials(ctx.Context(), shorturl)
+	s3Creds, err := pkg.Store.GetS3Credentials(ctx.Context(), shorturl)
 	if err == nil && s3Creds.Access != "" && s3Creds.Secret != "" {
-		// This URL has S3 credentials - generate a presigned URL
-		parsedURL, err := url.Parse(realurl)
-		if err != nil {
-			log.Error().Err(err).Str("url", realurl).Msg("failed to parse URL for presigning")
-			return ctx.Redirect().Status(fiber.StatusPermanentRedirect).To(realurl)
+		if presignedURL, expiry, err := presign(ctx, realurl, s3Creds); err == nil {
+			target, presigned = presignedURL, expiry
 		}
+	}
 
-		// Extract relevant parts from the URL
-		endpoint := parsedURL.Host
-		pathParts := strings.SplitN(strings.TrimPrefix(parsedURL.Path, "/"), "/", 2)
-		if len(pathParts) != 2 {
-			log.Error().Str("path", parsedURL.Path).Msg("invalid S3 URL path format")
-			return ctx.Redirect().Status(fiber.StatusPermanentRedirect).To(realurl)
-		}
+	return sendTo(ctx, link, target, ttl, presigned, left >= 0)
+}
+
+// presign turns an S3 URL into a presigned one using the credentials stored with the link
+func presign(ctx fiber.Ctx, realurl string, s3Creds types.S3Credentials) (string, time.Duration, error) {
+	parsedURL, err := url.Parse(realurl)
+	if err != nil {
+		log.Error().Err(err).Str("url", realurl).Msg("failed to parse URL for presigning")
+		return "", 0, err
+	}
+
+	// Extract relevant parts from the URL
+	endpoint := parsedURL.Host
+	pathParts := strings.SplitN(strings.TrimPrefix(parsedURL.Path, "/"), "/", 2)
+	if len(pathParts) != 2 {
+		log.Error().Str("path", parsedURL.Path).Msg("invalid S3 URL path format")
+		return "", 0, fmt.Errorf("invalid S3 URL path %s", parsedURL.Path)
+	}
+
+	bucket := pathParts[0]
+	objectName := pathParts[1]
+
+	// Initialize MinIO client with user credentials
+	s3Client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(s3Creds.Access, s3Creds.Secret, ""),
+		Secure: parsedURL.Scheme == "https",
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to initialize S3 client")
+		return "", 0, err
+	}
+
+	// Set expiry time (use app config or a default)
+	expiry := 7 * 24 * time.Hour // 7 days default
+	if config.Use.S3.Expired > 0 {
+		expiry = config.Use.S3.Expired
+	}
 
-		bucket := pathParts[0]
-		objectName := pathParts[1]
+	// Generate presigned URL
+	reqParams := make(url.Values)
+	presignedURL, err := s3Client.PresignedGetObject(ctx.Context(), bucket, objectName, expiry, reqParams)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate presigned URL")
+		return "", 0, err
+	}
 
-		// Initialize MinIO client with user credentials
-		s3Client, err := minio.New(endpoint, &minio.Options{
-			Creds:  credentials.NewStaticV4(s3Creds.Access, s3Creds.Secret, ""),
-			Secure: parsedURL.Scheme == "https",
+	return presignedURL.String(), expiry, nil
+}
+
+// sendTo redirects with the link's redirect type, ttl is what's left of the link (-1 never expires)
+// and presigned the lifetime of a presigned target
+func sendTo(ctx fiber.Ctx, link types.Link, target string, ttl, presigned time.Duration, limited bool) error {
+	ctx.Set(fiber.HeaderCacheControl, cacheControl(link, ttl, presigned, limited))
+
+	kind := link.Redirect
+	if kind == "" {
+		kind = defaultRedirect(link, ttl, presigned > 0)
+	}
+
+	// Never hand a non-web scheme to a meta refresh
+	if kind == types.RedirectRefresh && (strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")) {
+		return ctx.Render("refresh", fiber.Map{
+			"Url":   target,
+			"Delay": int(config.Use.Redirect.RefreshDelay.Seconds()),
 		})
-		
-		if err != nil {
-			log.Error().Err(err).Msg("failed to initialize S3 client")
-			return ctx.Redirect().Status(fiber.StatusPermanentRedirect).To(realurl)
-		}
+	}
 
-		// Set expiry time (use app config or a default)
-		expiry := 7 * 24 * time.Hour // 7 days default
-		if config.Use.S3.Expired > 0 {
-			expiry = config.Use.S3.Expired
-		}
+	status, err := strconv.Atoi(kind)
+	if err != nil {
+		status = fiber.StatusFound
+	}
 
-		// Generate presigned URL
-		reqParams := make(url.Values)
-		presignedURL, err := s3Client.PresignedGetObject(ctx.Context(), bucket, objectName, expiry, reqParams)
-		if err != nil {
-			log.Error().Err(err).Msg("failed to generate presigned URL")
-			return ctx.Redirect().Status(fiber.StatusPermanentRedirect).To(realurl)
-		}
+	return ctx.Redirect().Status(status).To(target)
+}
+
+// defaultRedirect only goes permanent when the target can't change under the client
+func defaultRedirect(link types.Link, ttl time.Duration, presigned bool) string {
+	if ttl >= 0 || presigned || link.Kind == types.KindFile || !link.NotAfter.IsZero() {
+		return types.RedirectFound
+	}
+
+	return types.RedirectPermanent
+}
+
+// cacheControl lets clients keep a redirect no longer than the link and its target stay valid. Only
+// links explicitly marked permanent may be cached, any other can be edited under the client.
+func cacheControl(link types.Link, ttl, presigned time.Duration, limited bool) string {
+	// Every click of these has to reach us
+	if limited || link.Password != "" {
+		return "no-store"
+	}
+
+	if link.Redirect != types.RedirectMoved && link.Redirect != types.RedirectPermanent {
+		return "no-cache, max-age=0"
+	}
+
+	age := config.Use.Redirect.MaxAge
+	if ttl >= 0 {
+		age = min(age, ttl)
+	}
+
+	if presigned > 0 {
+		age = min(age, presigned)
+	}
+
+	if !link.NotAfter.IsZero() {
+		age = min(age, time.Until(link.NotAfter))
+	}
+
+	if age < time.Second {
+		return "no-store"
+	}
+
+	return fmt.Sprintf("private, max-age=%d", int(age.Seconds()))
+}
+
+// streamObject serves an uploaded file through us, last deletes it once the response is sent
+func streamObject(ctx fiber.Ctx, objectName string, last bool) error {
+	object, err := utils.Storage.Conn().GetObject(context.Background(), config.Use.S3.Bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return err
+	}
+
+	ctx.Set(fiber.HeaderContentType, info.ContentType)
+	ctx.Set(fiber.HeaderContentDisposition, fmt.Sprintf("inline; filename=%q", path.Base(objectName)))
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+
+	// fasthttp closes the body stream after writing it
+	var body io.Reader = object
+	if last {
+		body = &deleteOnClose{Object: object, name: objectName}
+	}
+
+	return ctx.SendStream(body, int(info.Size))
+}
+
+type deleteOnClose struct {
+	*minio.Object
+	name string
+}
+
+func (d *deleteOnClose) Close() error {
+	err := d.Object.Close()
+	if err := utils.Storage.Delete(d.name); err != nil {
+		log.Error().Caller().Err(err).Str("file", d.name).Msg("failed to delete file after its last click")
+	}
+
+	return err
+}
+
+// recordClick hands the hit over to the analytics writer, it never touches Redis on the request path
+func recordClick(ctx fiber.Ctx, shorty string, expires time.Time) {
+	if pkg.Analytics == nil {
+		return
+	}
 
-		// Redirect to the presigned URL
-		return ctx.Redirect().Status(fiber.StatusPermanentRedirect).To(presignedURL.String())
+	var country string
+	if config.Use.App.Cloudflare {
+		country = ctx.Get("Cf-Ipcountry")
 	}
 
-	// No S3 credentials, just redirect to the stored URL
-	return ctx.Redirect().Status(fiber.StatusPermanentRedirect).To(realurl)
+	// fiber reuses its buffers after the handler returns, so copy everything we keep
+	pkg.Analytics.Record(pkg.NewClick(
+		strings.Clone(shorty),
+		strings.Clone(ctx.Get(fiber.HeaderReferer)),
+		strings.Clone(ctx.Get(fiber.HeaderUserAgent)),
+		strings.Clone(country),
+		strings.Clone(ctx.IP()),
+		expires,
+	))
 }
@@ -0,0 +1,398 @@
+package routes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"shorty/config"
+	"shorty/pkg"
+	"shorty/types"
+	"shorty/utils"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictRename    = "rename"
+)
+
+// importColumns maps the CSV headers of each format onto ExportRecord fields,
+// headers are matched lowercased with spaces turned into underscores
+var importColumns = map[string]map[string]string{
+	"bitly": {
+		"link":       "shorty",
+		"bitlink":    "shorty",
+		"long_url":   "url",
+		"title":      "notes",
+		"tags":       "tags",
+		"created_at": "created_at",
+	},
+	"yourls": {
+		"keyword":   "shorty",
+		"url":       "url",
+		"title":     "notes",
+		"timestamp": "created_at",
+	},
+}
+
+// importTimeLayouts covers our RFC3339 plus what Bitly and YOURLS write
+var importTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05-0700", "2006-01-02 15:04:05", "2006-01-02"}
+
+// importRow is a parsed line of the upload, Err is set when it could not be parsed
+type importRow struct {
+	Line   int
+	Record types.ExportRecord
+	Err    error
+}
+
+// Import creates links from an NDJSON or CSV upload (ours, Bitly or YOURLS) and reports every row
+func Import(ctx fiber.Ctx) error {
+	format := ctx.Query("format", "ndjson")
+	if format != "ndjson" && format != "csv" && importColumns[format] == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "format must be ndjson, csv, bitly or yourls")
+	}
+
+	conflict := ctx.Query("conflict", conflictSkip)
+	if conflict != conflictSkip && conflict != conflictOverwrite && conflict != conflictRename {
+		return fiber.NewError(fiber.StatusBadRequest, "conflict must be skip, overwrite or rename")
+	}
+
+	dryRun := fiber.Query[bool](ctx, "dry_run")
+
+	// Either a multipart "file" or the raw body
+	var data io.Reader = bytes.NewReader(ctx.Body())
+	if file, err := ctx.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		data = f
+	}
+
+	var rows []importRow
+	var err error
+	if format == "ndjson" {
+		rows, err = parseNDJSON(data)
+	} else {
+		rows, err = parseCSV(data, format)
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("cannot read %s: %v", format, err))
+	}
+
+	report := types.ImportReport{DryRun: dryRun, Rows: make([]types.ImportResult, 0, len(rows))}
+	for _, row := range rows {
+		result := types.ImportResult{Line: row.Line, Shorty: row.Record.Shorty}
+		if row.Err != nil {
+			result.Status, result.Error = types.ImportFailed, row.Err.Error()
+		} else {
+			result.Shorty, result.Status, err = importRecord(ctx, row.Record, conflict, dryRun)
+			if err != nil {
+				result.Status, result.Error = types.ImportFailed, err.Error()
+			}
+		}
+
+		switch result.Status {
+		case types.ImportFailed:
+			report.Failed++
+		case types.ImportSkipped:
+			report.Skipped++
+		default:
+			report.Created++
+		}
+
+		report.Rows = append(report.Rows, result)
+	}
+
+	return ctx.JSON(report)
+}
+
+// importRecord stores one record following the conflict policy and returns the shorty it ended up under
+func importRecord(ctx fiber.Ctx, record types.ExportRecord, conflict string, dryRun bool) (string, string, error) {
+	link, ttl, err := importLink(ctx, record)
+	if err != nil {
+		return record.Shorty, "", err
+	}
+
+	shorty := record.Shorty
+	if shorty != "" {
+		if shorty, err = validateAlias(shorty); err != nil {
+			return record.Shorty, "", err
+		}
+	}
+
+	status := types.ImportCreated
+	var existing types.Link
+	if shorty != "" {
+		if existing, err = pkg.Store.Get(ctx.Context(), shorty); err == nil {
+			switch conflict {
+			case conflictSkip:
+				return shorty, types.ImportSkipped, nil
+			case conflictOverwrite:
+				if !canManage(GetCaller(ctx), existing) {
+					return shorty, "", fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("%s is not yours", shorty))
+				}
+
+				// Its object would be left behind in the bucket
+				if existing.Kind == types.KindFile {
+					return shorty, "", fmt.Errorf("%s is an uploaded file and cannot be overwritten", shorty)
+				}
+				status = types.ImportOverwritten
+			case conflictRename:
+				shorty, status = "", types.ImportRenamed
+			}
+		}
+	}
+
+	if dryRun {
+		return shorty, status, nil
+	}
+
+	// Replaced in place, so the link is never missing and stays where it was if the write fails
+	if status == types.ImportOverwritten {
+		if ttl == 0 {
+			ttl = config.Use.TTL.Default
+		}
+		if ttl == 0 {
+			ttl = pkg.NoExpiry
+		}
+
+		// Records never carry credentials, the old ones must not sign the new destination
+		if err := pkg.Store.DelS3Credentials(ctx.Context(), shorty); err != nil {
+			return shorty, "", err
+		}
+
+		if err := saveLink(ctx, shorty, link, ttl, existing.Url); err != nil {
+			return shorty, "", err
+		}
+
+		audit(ctx, types.ActionImport, shorty, existing.Url, link.Url)
+
+		return shorty, status, nil
+	}
+
+	name, err := createLink(ctx, shorty, "", 0, link, types.S3Credentials{}, ttl)
+	if err != nil {
+		// Taken between the check and the write
+		if errors.Is(err, pkg.ErrAlreadyExists) && conflict == conflictSkip {
+			return shorty, types.ImportSkipped, nil
+		}
+		return shorty, "", err
+	}
+
+	audit(ctx, types.ActionImport, name, "", link.Url)
+
+	return name, status, nil
+}
+
+// importLink validates a record and turns it into a link and the ttl to store it with
+func importLink(ctx fiber.Ctx, record types.ExportRecord) (types.Link, time.Duration, error) {
+	// Exports only flag secrets and don't carry uploads, such links can't be recreated from them
+	switch {
+	case record.Kind == types.KindFile || record.Object != "":
+		return types.Link{}, 0, errors.New("uploaded files cannot be imported")
+	case record.Protected:
+		return types.Link{}, 0, errors.New("protected links cannot be imported, their password is not exported")
+	case record.HasCredentials:
+		return types.Link{}, 0, errors.New("links with S3 credentials cannot be imported")
+	}
+
+	// Destinations aren't probed, a large import would take forever
+	if err := pkg.CheckScheme(record.Url); err != nil {
+		return types.Link{}, 0, err
+	}
+
+	if err := pkg.CheckBlocklist(record.Url); err != nil {
+		return types.Link{}, 0, err
+	}
+
+	if record.Redirect != "" && !slices.Contains(types.Redirects, record.Redirect) {
+		return types.Link{}, 0, fmt.Errorf("invalid redirect %q", record.Redirect)
+	}
+
+	if record.MaxClicks < 0 {
+		return types.Link{}, 0, errors.New("max_clicks cannot be negative")
+	}
+
+	var ttl time.Duration
+	switch {
+	case record.Permanent:
+		ttl = pkg.NoExpiry
+	case !record.ExpiresAt.IsZero():
+		if ttl = time.Until(record.ExpiresAt); ttl < time.Second {
+			return types.Link{}, 0, errors.New("already expired")
+		}
+	}
+
+	link := pkg.NewLink(record.Url)
+	link.Notes = record.Notes
+	link.Redirect = record.Redirect
+	link.MaxClicks = record.MaxClicks
+	link.NotBefore = record.NotBefore.UTC()
+	link.NotAfter = record.NotAfter.UTC()
+
+	var err error
+	if link.Tags, err = normalizeTags(record.Tags); err != nil {
+		return types.Link{}, 0, err
+	}
+
+	if ttl, err = scheduleTTL(link, ttl); err != nil {
+		return types.Link{}, 0, err
+	}
+
+	if !record.CreatedAt.IsZero() {
+		link.CreatedAt = record.CreatedAt.UTC()
+	}
+
+	// Only admins may import on behalf of others
+	caller := GetCaller(ctx)
+	link.Owner = caller.Name
+	if caller.IsAdmin() && record.Owner != "" {
+		link.Owner = record.Owner
+	}
+
+	return link, ttl, nil
+}
+
+func parseNDJSON(r io.Reader) ([]importRow, error) {
+	var rows []importRow
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		row := importRow{Line: line}
+		row.Err = utils.FromJSON(data, &row.Record)
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
+
+func parseCSV(r io.Reader, format string) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	// Our own export uses the field names as headers
+	columns := importColumns[format]
+	fields := make([]string, len(header))
+	for i, name := range header {
+		name = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+		if columns == nil {
+			fields[i] = name
+		} else {
+			fields[i] = columns[name]
+		}
+	}
+
+	var rows []importRow
+	for line := 2; ; line++ {
+		values, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+
+		row := importRow{Line: line}
+		if err != nil {
+			row.Err = err
+		} else {
+			row.Record, row.Err = csvRecord(fields, values, format)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func csvRecord(fields, values []string, format string) (record types.ExportRecord, err error) {
+	for i, value := range values {
+		if i >= len(fields) || value == "" {
+			continue
+		}
+
+		switch fields[i] {
+		case "shorty":
+			// Bitly exports the whole bitlink, we only want its code
+			if format == "bitly" {
+				value = path.Base(strings.TrimSuffix(value, "/"))
+			}
+			record.Shorty = value
+		case "url":
+			record.Url = value
+		case "kind":
+			record.Kind = value
+		case "object":
+			record.Object = value
+		case "owner":
+			record.Owner = value
+		case "tags":
+			record.Tags = strings.FieldsFunc(value, func(r rune) bool { return r == '|' || r == ',' || r == ';' })
+			for j := range record.Tags {
+				record.Tags[j] = strings.TrimSpace(record.Tags[j])
+			}
+		case "notes":
+			record.Notes = value
+		case "redirect":
+			record.Redirect = value
+		case "max_clicks":
+			record.MaxClicks, err = strconv.ParseInt(value, 10, 64)
+		case "not_before":
+			record.NotBefore, err = parseImportTime(value)
+		case "not_after":
+			record.NotAfter, err = parseImportTime(value)
+		case "expires_at":
+			record.ExpiresAt, err = parseImportTime(value)
+		case "created_at":
+			record.CreatedAt, err = parseImportTime(value)
+		case "permanent":
+			record.Permanent, err = strconv.ParseBool(value)
+		case "protected":
+			record.Protected, err = strconv.ParseBool(value)
+		case "has_credentials":
+			record.HasCredentials, err = strconv.ParseBool(value)
+		}
+
+		if err != nil {
+			return record, fmt.Errorf("invalid %s: %v", fields[i], err)
+		}
+	}
+
+	return record, nil
+}
+
+func parseImportTime(value string) (time.Time, error) {
+	for _, layout := range importTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	// Unix seconds, as some exports write them
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+
+	return time.Time{}, fmt.Errorf("unknown time format %q", value)
+}
@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"shorty/types"
+)
+
+func TestCSVRecord(t *testing.T) {
+	created := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		format  string
+		fields  []string
+		values  []string
+		want    types.ExportRecord
+		wantErr string
+	}{
+		{
+			name:   "own export",
+			format: "csv",
+			fields: exportColumns,
+			values: []string{"abc", "https://example.com", "url", "", "alice", "a|b", "note", "301", "5",
+				"", "", "", "true", "", "", "2024-05-06T07:08:09Z"},
+			want: types.ExportRecord{
+				Shorty: "abc", Url: "https://example.com", Kind: "url", Owner: "alice", Tags: []string{"a", "b"},
+				Notes: "note", Redirect: "301", MaxClicks: 5, Permanent: true, CreatedAt: created,
+			},
+		},
+		{
+			name:   "secrets are flagged",
+			format: "csv",
+			fields: []string{"shorty", "kind", "object", "protected", "has_credentials"},
+			values: []string{"abc", "file", "uploads/a.pdf", "true", "true"},
+			want:   types.ExportRecord{Shorty: "abc", Kind: "file", Object: "uploads/a.pdf", Protected: true, HasCredentials: true},
+		},
+		{
+			name:   "bitly keeps only the code",
+			format: "bitly",
+			fields: []string{"shorty", "url", "notes", "tags", "created_at"},
+			values: []string{"https://bit.ly/3xYz/", "https://example.com", "Title", "one, two;three", "2024-05-06T07:08:09+0000"},
+			want: types.ExportRecord{
+				Shorty: "3xYz", Url: "https://example.com", Notes: "Title", Tags: []string{"one", "two", "three"}, CreatedAt: created,
+			},
+		},
+		{
+			name:   "csv keeps a slash",
+			format: "csv",
+			fields: []string{"shorty"},
+			values: []string{"a/b"},
+			want:   types.ExportRecord{Shorty: "a/b"},
+		},
+		{
+			name:   "yourls timestamp",
+			format: "yourls",
+			fields: []string{"shorty", "url", "notes", "created_at"},
+			values: []string{"ozh", "https://example.com", "", "2024-05-06 07:08:09"},
+			want:   types.ExportRecord{Shorty: "ozh", Url: "https://example.com", CreatedAt: created},
+		},
+		{
+			name:   "unix seconds",
+			format: "csv",
+			fields: []string{"created_at"},
+			values: []string{"1714979289"},
+			want:   types.ExportRecord{CreatedAt: created},
+		},
+		{
+			name:   "unknown and extra columns are ignored",
+			format: "bitly",
+			fields: []string{"shorty", "", "url"},
+			values: []string{"abc", "ignored", "https://example.com", "no header"},
+			want:   types.ExportRecord{Shorty: "abc", Url: "https://example.com"},
+		},
+		{
+			name:   "short row",
+			format: "csv",
+			fields: exportColumns,
+			values: []string{"abc"},
+			want:   types.ExportRecord{Shorty: "abc"},
+		},
+		{
+			name:    "bad max_clicks",
+			format:  "csv",
+			fields:  []string{"max_clicks"},
+			values:  []string{"many"},
+			wantErr: "invalid max_clicks",
+		},
+		{
+			name:    "bad time",
+			format:  "csv",
+			fields:  []string{"not_before"},
+			values:  []string{"tomorrow"},
+			wantErr: "invalid not_before",
+		},
+		{
+			name:    "bad bool",
+			format:  "csv",
+			fields:  []string{"protected"},
+			values:  []string{"maybe"},
+			wantErr: "invalid protected",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := csvRecord(tt.fields, tt.values, tt.format)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("csvRecord error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("csvRecord error = %v", err)
+			}
+
+			// Times are compared by instant, the parsed ones may carry another location
+			if !got.CreatedAt.Equal(tt.want.CreatedAt) {
+				t.Errorf("csvRecord created_at = %v, want %v", got.CreatedAt, tt.want.CreatedAt)
+			}
+			got.CreatedAt, tt.want.CreatedAt = time.Time{}, time.Time{}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("csvRecord = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,25 +1,174 @@
 package routes
 
 import (
+	"cmp"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
 	"shorty/pkg"
 	"shorty/types"
 
 	"github.com/gofiber/fiber/v3"
 )
 
+const (
+	listDefaultLimit = 50
+	listMaxLimit     = 500
+)
+
+// List pages through links with a cursor, the total of matching links is sent as X-Total-Count
+// and the cursor of the next page as X-Next-Cursor
 func List(ctx fiber.Ctx) error {
-	list, err := pkg.Redis.GetAll(ctx.Context())
+	filter := types.LinkFilter{
+		Prefix: ctx.Query("prefix"),
+		Owner:  ctx.Query("owner"),
+		Kind:   ctx.Query("kind"),
+		Tag:    ctx.Query("tag"),
+		Health: ctx.Query("health"),
+	}
+
+	if filter.Kind != "" && filter.Kind != types.KindURL && filter.Kind != types.KindFile {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("kind must be %s or %s", types.KindURL, types.KindFile))
+	}
+
+	if filter.Health != "" && filter.Health != types.HealthOK && filter.Health != types.HealthBroken && filter.Health != types.HealthUnknown {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("health must be %s, %s or %s", types.HealthOK, types.HealthBroken, types.HealthUnknown))
+	}
+
+	for param, dst := range map[string]*time.Time{"expires_after": &filter.ExpiresAfter, "expires_before": &filter.ExpiresBefore} {
+		value := ctx.Query(param)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid "+param+", expected RFC3339: "+err.Error())
+		}
+		*dst = t
+	}
+
+	sortBy := ctx.Query("sort", "created")
+	if sortBy != "created" && sortBy != "expires" {
+		return fiber.NewError(fiber.StatusBadRequest, "sort must be created or expires")
+	}
+
+	order := ctx.Query("order", "desc")
+	if order != "asc" && order != "desc" {
+		return fiber.NewError(fiber.StatusBadRequest, "order must be asc or desc")
+	}
+
+	limit := fiber.Query(ctx, "limit", listDefaultLimit)
+	if limit < 1 || limit > listMaxLimit {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", listMaxLimit))
+	}
+
+	var after *listCursor
+	if raw := ctx.Query("cursor"); raw != "" {
+		cursor, err := decodeCursor(raw)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid cursor")
+		}
+		after = &cursor
+	}
+
+	compare := func(a, b listCursor) int {
+		// Ties are always broken by shorty ascending, so pages stay stable
+		if c := cmp.Compare(a.Key, b.Key); c != 0 {
+			if order == "desc" {
+				return -c
+			}
+			return c
+		}
+		return strings.Compare(a.Shorty, b.Shorty)
+	}
+
+	caller := GetCaller(ctx)
+	all := fiber.Query[bool](ctx, "all") && canListAll(caller)
+
+	// Only the page being asked for is kept, plus one link to tell whether another page follows
+	total := 0
+	page := make([]types.Shorten, 0, limit+1)
+	err := pkg.Store.Each(ctx.Context(), func(item types.Shorten) bool {
+		item, ok := inScope(caller, all, item)
+		if !ok || !filter.Match(item) {
+			return true
+		}
+
+		total++
+
+		// Everything up to and including the cursor was already served
+		pos := cursorOf(item, sortBy)
+		if after != nil && compare(pos, *after) <= 0 {
+			return true
+		}
+
+		i, _ := slices.BinarySearchFunc(page, pos, func(p types.Shorten, target listCursor) int {
+			return compare(cursorOf(p, sortBy), target)
+		})
+		if i <= limit {
+			page = slices.Insert(page, i, item)
+			page = page[:min(len(page), limit+1)]
+		}
+
+		return true
+	})
 	if err != nil {
 		return err
 	}
 
-	// re-check
-	if len(list) == 0 {
-		return ctx.Status(404).JSON(types.Response{
-			Error:   true,
-			Message: "still empty",
-		})
+	ctx.Set("X-Total-Count", strconv.Itoa(total))
+	if len(page) > limit {
+		page = page[:limit]
+		ctx.Set("X-Next-Cursor", cursorOf(page[len(page)-1], sortBy).encode())
+	}
+
+	return ctx.JSON(page)
+}
+
+// listCursor is the sort position of the last link of a page
+type listCursor struct {
+	Key    int64
+	Shorty string
+}
+
+// cursorOf gives links that never expire the latest possible expiry
+func cursorOf(s types.Shorten, sortBy string) listCursor {
+	key := s.CreatedAt.UnixMilli()
+	if sortBy == "expires" {
+		key = math.MaxInt64
+		if !s.ExpiresAt.IsZero() {
+			key = s.ExpiresAt.UnixMilli()
+		}
+	}
+
+	return listCursor{Key: key, Shorty: s.Shorty}
+}
+
+func (c listCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.Key, 10) + ":" + c.Shorty))
+}
+
+func decodeCursor(raw string) (listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return listCursor{}, err
+	}
+
+	key, shorty, ok := strings.Cut(string(data), ":")
+	if !ok {
+		return listCursor{}, fmt.Errorf("malformed cursor")
+	}
+
+	n, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return listCursor{}, err
 	}
 
-	return ctx.JSON(list)
+	return listCursor{Key: n, Shorty: shorty}, nil
 }
@@ -0,0 +1,76 @@
+package routes
+
+import (
+	"encoding/base64"
+	"math"
+	"testing"
+	"time"
+
+	"shorty/types"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name    string
+		raw     string
+		want    listCursor
+		wantErr bool
+	}{
+		{name: "created", raw: encode("1700000000000:abc"), want: listCursor{Key: 1700000000000, Shorty: "abc"}},
+		{name: "never expires", raw: encode("9223372036854775807:abc"), want: listCursor{Key: math.MaxInt64, Shorty: "abc"}},
+		{name: "negative key", raw: encode("-5:abc"), want: listCursor{Key: -5, Shorty: "abc"}},
+		{name: "colon in shorty", raw: encode("1:a:b"), want: listCursor{Key: 1, Shorty: "a:b"}},
+		{name: "empty shorty", raw: encode("1:"), want: listCursor{Key: 1}},
+		{name: "padded base64", raw: base64.URLEncoding.EncodeToString([]byte("1:abc")), wantErr: true},
+		{name: "not base64", raw: "!!!", wantErr: true},
+		{name: "no separator", raw: encode("1700000000000"), wantErr: true},
+		{name: "key not a number", raw: encode("soon:abc"), wantErr: true},
+		{name: "key overflows", raw: encode("9223372036854775808:abc"), wantErr: true},
+		{name: "empty", raw: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCursor(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeCursor(%q) error = %v, want error %v", tt.raw, err, tt.wantErr)
+			}
+
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("decodeCursor(%q) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	expires := created.Add(48 * time.Hour)
+
+	tests := []struct {
+		name   string
+		item   types.Shorten
+		sortBy string
+		want   listCursor
+	}{
+		{"created", types.Shorten{Shorty: "abc", CreatedAt: created}, "created", listCursor{created.UnixMilli(), "abc"}},
+		{"expires", types.Shorten{Shorty: "abc", CreatedAt: created, ExpiresAt: expires}, "expires", listCursor{expires.UnixMilli(), "abc"}},
+		{"permanent last", types.Shorten{Shorty: "abc", CreatedAt: created, Permanent: true}, "expires", listCursor{math.MaxInt64, "abc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := cursorOf(tt.item, tt.sortBy)
+			if cursor != tt.want {
+				t.Fatalf("cursorOf = %+v, want %+v", cursor, tt.want)
+			}
+
+			got, err := decodeCursor(cursor.encode())
+			if err != nil || got != cursor {
+				t.Errorf("decodeCursor(encode(%+v)) = %+v, %v", cursor, got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"strings"
+
+	"shorty/pkg"
+	"shorty/types"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func Search(ctx fiber.Ctx) error {
+	if pkg.Search == nil {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "search is disabled")
+	}
+
+	query := types.SearchQuery{
+		Q:     strings.TrimSpace(ctx.Query("q")),
+		Owner: ctx.Query("owner"),
+		Limit: fiber.Query(ctx, "limit", 50),
+	}
+
+	if tags := ctx.Query("tag"); tags != "" {
+		query.Tags = strings.Split(tags, ",")
+	}
+
+	if query.Limit < 1 || query.Limit > 500 {
+		return fiber.NewError(fiber.StatusBadRequest, "limit must be between 1 and 500")
+	}
+
+	// Without all the caller only sees their own links, so only search those
+	caller := GetCaller(ctx)
+	all := fiber.Query[bool](ctx, "all")
+	if !all || !canListAll(caller) {
+		query.Owner = caller.Name
+	}
+
+	shorties, err := pkg.Search.Search(ctx.Context(), query)
+	if err != nil {
+		return err
+	}
+
+	results := make([]types.Shorten, 0, len(shorties))
+	for _, shorty := range shorties {
+		link, err := pkg.Store.Get(ctx.Context(), shorty)
+		if err != nil {
+			// Expired or removed since it was indexed
+			pkg.UnindexLink(ctx.Context(), shorty)
+			continue
+		}
+
+		ttl, err := pkg.Store.TTL(ctx.Context(), shorty)
+		if err != nil {
+			continue
+		}
+
+		results = append(results, link.Shorten(shorty, ttl))
+	}
+
+	return ctx.JSON(ScopeToCaller(caller, all, results))
+}
@@ -1,14 +1,19 @@
 package routes
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
+	"shorty/config"
 	"shorty/pkg"
 	"shorty/types"
-	"shorty/utils"
 
 	"github.com/gofiber/fiber/v3"
-	"github.com/gofiber/fiber/v3/client"
+	"github.com/rs/zerolog/log"
 )
 
 func Shorten(ctx fiber.Ctx) error {
@@ -17,48 +22,177 @@ func Shorten(ctx fiber.Ctx) error {
 		return err
 	}
 
-	if body.Url == "" {
-		return fmt.Errorf("url cannot be empty")
+	link, ttl, err := prepareShorten(&body, GetCaller(ctx).Name)
+	if err != nil {
+		return err
 	}
 
-	// Check that url
-	cc := client.New()
-	testUrl, err := cc.Head(body.Url)
+	body.Shorty, err = createLink(ctx, body.Shorty, body.Generator, body.Length, link, body.S3Key, ttl)
 	if err != nil {
-		return fmt.Errorf("error when reach %s: %v", body.Url, err)
+		return err
+	}
+
+	if !body.SkipCheck {
+		pkg.ValidateAsync(body.Shorty, body.Url)
+	}
+
+	audit(ctx, types.ActionCreate, body.Shorty, "", body.Url)
+
+	return ctx.JSON(types.Response{
+		Error:   false,
+		Message: fmt.Sprintf("%s/%s", ctx.BaseURL(), body.Shorty),
+	})
+}
+
+// prepareShorten validates a create request, checks its destination and builds the link to store.
+// The alias in body is normalized in place.
+func prepareShorten(body *types.Shorten, owner string) (types.Link, time.Duration, error) {
+	if body.Url == "" {
+		return types.Link{}, 0, fmt.Errorf("url cannot be empty")
+	}
+
+	var err error
+	if body.Shorty != "" {
+		if body.Shorty, err = validateAlias(body.Shorty); err != nil {
+			return types.Link{}, 0, err
+		}
+	}
+
+	if body.Generator != "" && !pkg.IsGenerator(body.Generator) {
+		return types.Link{}, 0, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("unknown generator %s", body.Generator))
+	}
+
+	if body.Length < 0 || body.Length > config.Use.Generator.MaxLength {
+		return types.Link{}, 0, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("length must be 0 (default) to %d", config.Use.Generator.MaxLength))
+	}
+
+	if body.Expired < 0 {
+		return types.Link{}, 0, fiber.NewError(fiber.StatusBadRequest, "expired cannot be negative, use permanent for links that never expire")
+	}
+
+	if body.MaxClicks < 0 {
+		return types.Link{}, 0, fiber.NewError(fiber.StatusBadRequest, "max_clicks cannot be negative")
+	}
+
+	if !body.NotBefore.IsZero() && !body.NotAfter.IsZero() && !body.NotAfter.After(body.NotBefore) {
+		return types.Link{}, 0, fiber.NewError(fiber.StatusBadRequest, "not_after must be later than not_before")
+	}
+
+	if body.Redirect != "" && !slices.Contains(types.Redirects, body.Redirect) {
+		return types.Link{}, 0, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("redirect must be one of %s", strings.Join(types.Redirects, ", ")))
+	}
+
+	if err := checkURL(body.Url); err != nil {
+		return types.Link{}, 0, err
+	}
+
+	link := pkg.NewLink(body.Url)
+	if link.Tags, err = normalizeTags(body.Tags); err != nil {
+		return types.Link{}, 0, err
+	}
+	link.Notes = body.Notes
+	link.MaxClicks = body.MaxClicks
+	link.NotBefore = body.NotBefore.UTC()
+	link.NotAfter = body.NotAfter.UTC()
+	link.Redirect = body.Redirect
+	link.Owner = owner
+
+	if link.Password, err = hashPassword(body.Password); err != nil {
+		return types.Link{}, 0, err
+	}
+
+	ttl := body.Expired
+	if body.Permanent {
+		ttl = pkg.NoExpiry
 	}
 
-	statusCode := testUrl.StatusCode()
-	if statusCode == 404 || statusCode >= 500 {
-		return fmt.Errorf("cannot reach %s, status code: %d", body.Url, statusCode)
+	if ttl, err = scheduleTTL(link, ttl); err != nil {
+		return types.Link{}, 0, err
+	}
+
+	return link, ttl, nil
+}
+
+// scheduleTTL makes sure the link is still around during its activation window. The default ttl is
+// stretched up to not_after, an explicit one that ends before not_before is rejected.
+func scheduleTTL(link types.Link, ttl time.Duration) (time.Duration, error) {
+	if ttl == 0 && config.Use.TTL.Default > 0 && time.Until(link.NotAfter) > config.Use.TTL.Default {
+		ttl = time.Until(link.NotAfter)
+	}
+
+	expires := ttl
+	if expires == 0 {
+		expires = config.Use.TTL.Default
+	}
+
+	if expires > 0 && !link.NotBefore.IsZero() && !time.Now().Add(expires).After(link.NotBefore) {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "not_before must be earlier than the expiry")
+	}
+
+	return ttl, nil
+}
+
+// checkURL rejects destinations we may not link to without touching the network, whether they
+// answer is found out by pkg.ValidateAsync once the link is stored
+func checkURL(target string) error {
+	if err := pkg.CheckBlocklist(target); err != nil {
+		return err
 	}
 
-	if body.Shorty == "" {
-		body.Shorty = utils.HumanFriendlyEnglishString(8)
+	return pkg.CheckScheme(target)
+}
+
+// linkCreated indexes a link stored under a free shorty and drops the stats a previous link
+// there may have left behind
+func linkCreated(ctx context.Context, name string, link types.Link) {
+	if err := pkg.Analytics.Purge(ctx, name); err != nil {
+		log.Warn().Err(err).Str("shorty", name).Msg("failed to purge stale stats")
 	}
 
-	// Check if S3 credentials are provided
-	if body.S3Key.Access != "" && body.S3Key.Secret != "" {
-		// Store URL with S3 credentials
-		if err := pkg.Redis.SetWithS3Credentials(
-			ctx.Context(), 
-			body.Shorty, 
-			body.Url, 
-			body.S3Key, 
-			body.Expired, 
-			true,
-		); err != nil {
-			return err
+	pkg.IndexLink(ctx, name, link)
+}
+
+// maxGenerateAttempts bounds retries when a generated shorty is already taken
+const maxGenerateAttempts = 5
+
+// createLink stores a new link without overwriting anything, an empty shorty gets a name from
+// generator that is retried on collision. It returns the shorty the link was stored under.
+func createLink(ctx fiber.Ctx, shorty, generator string, length int, link types.Link, s3Key types.S3Credentials, ttl time.Duration) (string, error) {
+	generated := shorty == ""
+
+	for attempt := range maxGenerateAttempts {
+		name := shorty
+		if generated {
+			var err error
+			if name, err = pkg.GenerateShorty(ctx.Context(), generator, length, attempt); err != nil {
+				return "", err
+			}
+
+			if IsReserved(name) {
+				continue
+			}
 		}
-	} else {
-		// Regular URL without S3 credentials
-		if err := pkg.Redis.Set(ctx.Context(), body.Shorty, body.Url, body.Expired, true); err != nil {
-			return err
+
+		var err error
+		if s3Key.Access != "" && s3Key.Secret != "" {
+			// Store URL with S3 credentials
+			err = pkg.Store.SetWithS3Credentials(ctx.Context(), name, link, s3Key, ttl, true)
+		} else {
+			err = pkg.Store.Set(ctx.Context(), name, link, ttl, true)
+		}
+
+		if err == nil {
+			if generated {
+				pkg.Crowded(generator, attempt)
+			}
+			linkCreated(ctx.Context(), name, link)
+			return name, nil
+		}
+
+		if !generated || !errors.Is(err, pkg.ErrAlreadyExists) {
+			return "", err
 		}
 	}
 
-	return ctx.JSON(types.Response{
-		Error:   false,
-		Message: fmt.Sprintf("%s/%s", ctx.BaseURL(), body.Shorty),
-	})
+	return "", fmt.Errorf("could not generate a free shorty after %d attempts: %w", maxGenerateAttempts, pkg.ErrAlreadyExists)
 }
@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"fmt"
+
+	"shorty/pkg"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func Stats(ctx fiber.Ctx) error {
+	if pkg.Analytics == nil {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "analytics is disabled")
+	}
+
+	shorturl := ctx.Params("shorty")
+	link, err := pkg.Store.Get(ctx.Context(), shorturl)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+
+	if !canManage(GetCaller(ctx), link) {
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("%s is not yours", shorturl))
+	}
+
+	hours := fiber.Query(ctx, "hours", 24)
+	days := fiber.Query(ctx, "days", 30)
+	top := fiber.Query(ctx, "top", 10)
+
+	if hours < 1 || hours > 24*31 || days < 1 || days > 366 || top < 1 {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid range: hours=%d days=%d top=%d", hours, days, top))
+	}
+
+	stats, err := pkg.Analytics.Stats(ctx.Context(), shorturl, hours, days, int64(top))
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(stats)
+}
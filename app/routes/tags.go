@@ -0,0 +1,227 @@
+package routes
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"shorty/pkg"
+	"shorty/types"
+	"shorty/utils"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const maxTagLength = 64
+
+// normalizeTags slugifies and dedupes tags so "Summer Sale" and "summer-sale" are the same tag
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		slug := utils.NormalizeAlias(tag)
+		if slug == "" || len(slug) > maxTagLength {
+			return nil, fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("invalid tag %q, must be 1 to %d characters", tag, maxTagLength))
+		}
+
+		if !slices.Contains(normalized, slug) {
+			normalized = append(normalized, slug)
+		}
+	}
+
+	return normalized, nil
+}
+
+// tagParam reads the tag from the path, normalized the way stored tags are
+func tagParam(ctx fiber.Ctx) (string, error) {
+	tags, err := normalizeTags([]string{ctx.Params("tag")})
+	if err != nil {
+		return "", err
+	}
+
+	return tags[0], nil
+}
+
+// ListTags counts links per tag, only the caller's own links unless all is asked for
+func ListTags(ctx fiber.Ctx) error {
+	caller := GetCaller(ctx)
+	all := fiber.Query[bool](ctx, "all")
+
+	var counts map[string]int64
+	if all && canListAll(caller) {
+		var err error
+		if counts, err = pkg.Store.TagCounts(ctx.Context()); err != nil {
+			return err
+		}
+	} else {
+		list, err := pkg.Store.List(ctx.Context())
+		if err != nil {
+			return err
+		}
+
+		counts = make(map[string]int64)
+		for _, item := range ScopeToCaller(caller, false, list) {
+			for _, tag := range item.Tags {
+				counts[tag]++
+			}
+		}
+	}
+
+	tags := make([]types.TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, types.TagCount{Tag: tag, Count: count})
+	}
+
+	slices.SortFunc(tags, func(a, b types.TagCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Tag, b.Tag)
+	})
+
+	return ctx.JSON(tags)
+}
+
+// TaggedLinks lists the links carrying a tag
+func TaggedLinks(ctx fiber.Ctx) error {
+	tag, err := tagParam(ctx)
+	if err != nil {
+		return err
+	}
+
+	shorties, err := pkg.Store.Tagged(ctx.Context(), tag)
+	if err != nil {
+		return err
+	}
+
+	list := make([]types.Shorten, 0, len(shorties))
+	for _, shorty := range shorties {
+		link, err := pkg.Store.Get(ctx.Context(), shorty)
+		if err != nil {
+			continue
+		}
+
+		ttl, err := pkg.Store.TTL(ctx.Context(), shorty)
+		if err != nil {
+			continue
+		}
+
+		list = append(list, link.Shorten(shorty, ttl))
+	}
+
+	return ctx.JSON(ScopeToCaller(GetCaller(ctx), fiber.Query[bool](ctx, "all"), list))
+}
+
+// BulkTag adds and removes tags on every listed link the caller may manage
+func BulkTag(ctx fiber.Ctx) error {
+	var body types.BulkTagRequest
+	if err := ctx.Bind().Body(&body); err != nil {
+		return err
+	}
+
+	add, err := normalizeTags(body.Add)
+	if err != nil {
+		return err
+	}
+
+	remove, err := normalizeTags(body.Remove)
+	if err != nil {
+		return err
+	}
+
+	if len(body.Shorties) == 0 || len(add)+len(remove) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "shorties and at least one tag to add or remove are required")
+	}
+
+	results := make([]types.BulkResult, 0, len(body.Shorties))
+	for _, shorty := range body.Shorties {
+		results = append(results, bulkResult(shorty, retag(ctx, shorty, add, remove)))
+	}
+
+	return ctx.JSON(results)
+}
+
+func retag(ctx fiber.Ctx, shorty string, add, remove []string) error {
+	link, err := pkg.Store.Get(ctx.Context(), shorty)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+
+	if !canManage(GetCaller(ctx), link) {
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("%s is not yours", shorty))
+	}
+
+	oldTags := strings.Join(link.Tags, ",")
+	tags := slices.DeleteFunc(slices.Clone(link.Tags), func(tag string) bool {
+		return slices.Contains(remove, tag)
+	})
+	for _, tag := range add {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	link.Tags = tags
+
+	if err := saveLink(ctx, shorty, link, 0, link.Url); err != nil {
+		return err
+	}
+
+	audit(ctx, types.ActionTag, shorty, oldTags, strings.Join(link.Tags, ","))
+	return nil
+}
+
+// DeleteTag deletes every link in a tag the caller may manage
+func DeleteTag(ctx fiber.Ctx) error {
+	tag, err := tagParam(ctx)
+	if err != nil {
+		return err
+	}
+
+	shorties, err := pkg.Store.Tagged(ctx.Context(), tag)
+	if err != nil {
+		return err
+	}
+
+	results := make([]types.BulkResult, 0, len(shorties))
+	for _, shorty := range shorties {
+		link, err := pkg.Store.Get(ctx.Context(), shorty)
+		if err != nil {
+			results = append(results, bulkResult(shorty, fiber.NewError(fiber.StatusNotFound, err.Error())))
+			continue
+		}
+
+		if !canManage(GetCaller(ctx), link) {
+			results = append(results, bulkResult(shorty, fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("%s is not yours", shorty))))
+			continue
+		}
+
+		results = append(results, bulkResult(shorty, deleteLink(ctx, shorty, link)))
+	}
+
+	return ctx.JSON(results)
+}
+
+// bulkResult turns the error of one item into its status, the same way errHandler would
+func bulkResult(shorty string, err error) types.BulkResult {
+	result := types.BulkResult{Shorty: shorty, Status: fiber.StatusOK}
+	if err == nil {
+		return result
+	}
+
+	result.Status = fiber.StatusInternalServerError
+	result.Error = err.Error()
+
+	var e *fiber.Error
+	var ue *pkg.URLError
+	if errors.As(err, &e) {
+		result.Status = e.Code
+	} else if errors.As(err, &ue) {
+		result.Status = fiber.StatusUnprocessableEntity
+		result.Reason = ue.Reason
+	} else if errors.Is(err, pkg.ErrAlreadyExists) {
+		result.Status = fiber.StatusConflict
+	}
+
+	return result
+}
@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"shorty/pkg"
+	"shorty/types"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func ListTokens(ctx fiber.Ctx) error {
+	tokens, err := pkg.RedisAuth.ListTokens(ctx.Context())
+	if err != nil {
+		return err
+	}
+
+	caller := GetCaller(ctx)
+	all := caller.IsAdmin() && fiber.Query[bool](ctx, "all")
+
+	list := make([]types.Token, 0, len(tokens))
+	for _, token := range tokens {
+		if all || token.Owner == caller.Name {
+			list = append(list, token)
+		}
+	}
+
+	slices.SortFunc(list, func(a, b types.Token) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	return ctx.JSON(list)
+}
+
+func CreateToken(ctx fiber.Ctx) error {
+	caller := GetCaller(ctx)
+
+	// A token minting tokens would outlive its own revocation
+	if strings.HasPrefix(caller.Method, "token:") {
+		return fiber.NewError(fiber.StatusForbidden, "tokens cannot create tokens")
+	}
+
+	var body types.TokenRequest
+	if err := ctx.Bind().Body(&body); err != nil {
+		return err
+	}
+
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "token name cannot be empty")
+	}
+
+	if len(body.Scopes) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("at least one scope is required: %s", strings.Join(types.Scopes, ", ")))
+	}
+
+	for _, scope := range body.Scopes {
+		if !slices.Contains(types.Scopes, scope) {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("unknown scope %s", scope))
+		}
+	}
+
+	if !body.ExpiresAt.IsZero() && body.ExpiresAt.Before(time.Now()) {
+		return fiber.NewError(fiber.StatusBadRequest, "expires_at must be in the future")
+	}
+
+	token, raw, err := pkg.RedisAuth.CreateToken(ctx.Context(), types.Token{
+		Name:      body.Name,
+		Owner:     caller.Name,
+		Role:      caller.Role,
+		Groups:    caller.Groups,
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(body.Scopes))),
+		ExpiresAt: body.ExpiresAt.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	audit(ctx, types.ActionTokenCreate, "", "", token.Name)
+
+	return ctx.Status(fiber.StatusCreated).JSON(types.Response{
+		Error:   false,
+		Message: raw,
+		Data:    token,
+	})
+}
+
+func RevokeToken(ctx fiber.Ctx) error {
+	id := ctx.Params("id")
+
+	token, err := pkg.RedisAuth.GetToken(ctx.Context(), id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+
+	caller := GetCaller(ctx)
+	if !caller.IsAdmin() && token.Owner != caller.Name {
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("token %s is not yours", id))
+	}
+
+	if err := pkg.RedisAuth.RevokeToken(ctx.Context(), id); err != nil {
+		return err
+	}
+
+	audit(ctx, types.ActionTokenRevoke, "", token.Name, "")
+
+	return ctx.JSON(types.Response{
+		Error:   false,
+		Message: fmt.Sprintf("token %s revoked", token.Name),
+	})
+}
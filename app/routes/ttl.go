@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"fmt"
+	"time"
+
+	"shorty/config"
+	"shorty/pkg"
+	"shorty/types"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// SetTTL extends, shortens or removes the expiry of a link, uploads get a matching presigned URL
+func SetTTL(ctx fiber.Ctx) error {
+	shorturl := ctx.Params("shorty")
+	link, err := pkg.Store.Get(ctx.Context(), shorturl)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+
+	if !canManage(GetCaller(ctx), link) {
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("%s is not yours", shorturl))
+	}
+
+	var body types.TTLRequest
+	if err := ctx.Bind().Body(&body); err != nil {
+		return err
+	}
+
+	var ttl time.Duration
+	switch {
+	case body.Permanent && body.Expired == 0 && body.ExpiresAt.IsZero():
+		ttl = pkg.NoExpiry
+	case !body.Permanent && body.Expired > 0 && body.ExpiresAt.IsZero():
+		ttl = body.Expired
+	case !body.Permanent && body.Expired == 0 && !body.ExpiresAt.IsZero():
+		ttl = time.Until(body.ExpiresAt)
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "set exactly one of expired, expires_at or permanent")
+	}
+
+	if ttl != pkg.NoExpiry && ttl < time.Second {
+		return fiber.NewError(fiber.StatusBadRequest, "expiry must be in the future")
+	}
+
+	if err := presignUpload(ctx, &link, ttl); err != nil {
+		return err
+	}
+
+	// The presigned URL is no new destination, so nothing goes into history
+	if err := saveLink(ctx, shorturl, link, ttl, link.Url); err != nil {
+		return err
+	}
+
+	expires := "never"
+	if ttl > 0 {
+		expires = time.Now().Add(ttl).UTC().Format(time.RFC3339)
+	}
+
+	audit(ctx, types.ActionExpire, shorturl, "", expires)
+
+	return ctx.JSON(types.Response{
+		Error:   false,
+		Message: fmt.Sprintf("%s expires %s", shorturl, expires),
+	})
+}
+
+// presignUpload gives an upload a presigned URL that lasts as long as the link's new ttl
+func presignUpload(ctx fiber.Ctx, link *types.Link, ttl time.Duration) error {
+	if !config.Use.S3.Enable || link.Kind != types.KindFile || link.Object == "" {
+		return nil
+	}
+
+	presigned, _, err := presignObject(ctx, link.Object, ttl)
+	if err != nil {
+		return fmt.Errorf("failed to get presigned url: %v", err)
+	}
+
+	link.Url = presigned
+	return nil
+}
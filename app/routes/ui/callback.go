@@ -70,8 +70,19 @@ func Callback(ctx fiber.Ctx) error {
 		return ctx.Redirect().To(basePath + "/login?error=External users are not allowed to login")
 	}
 
+	// Group membership is only needed when roles are granted by group
+	var groups []string
+	if hasGroupRoles() {
+		groups, err = fetchGroups(cc, token.AccessToken)
+		if err != nil {
+			log.Error().Err(err).Str("username", user.Username).Msg("failed to fetch user groups")
+			return ctx.Redirect().To(basePath + "/login?error=Failed to fetch user groups")
+		}
+	}
+
 	// Set session
 	sess.Set("name", user.Username)
+	sess.Set("groups", strings.Join(groups, ","))
 	if err := sess.Save(); err != nil {
 		log.Error().Err(err).Msg("failed to save session")
 		return ctx.Redirect().To(basePath + "/login?error=Failed to create user session")
@@ -79,3 +90,26 @@ func Callback(ctx fiber.Ctx) error {
 
 	return ctx.Redirect().To(basePath + "/")
 }
+
+// fetchGroups reads the full paths of the user's groups from GitLab's OpenID userinfo
+func fetchGroups(cc *client.Client, accessToken string) ([]string, error) {
+	resp, err := cc.Get(fmt.Sprintf("%s/oauth/userinfo", config.Use.Oauth.BaseURL), client.Config{
+		Header: map[string]string{
+			"Authorization": fmt.Sprintf("Bearer %s", accessToken),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != fiber.StatusOK {
+		return nil, fmt.Errorf("userinfo returned status code %d", resp.StatusCode())
+	}
+
+	var info oauthUserInfoResponse
+	if err := json.Unmarshal(resp.Body(), &info); err != nil {
+		return nil, err
+	}
+
+	return info.Groups, nil
+}
@@ -2,12 +2,26 @@ package ui
 
 import (
 	"errors"
+	"shorty/app/routes"
 	"shorty/config"
 	"shorty/types"
+	"strings"
 
 	"github.com/gofiber/fiber/v3"
 )
 
+// Session is the middleware form of validateSession for the UI routes
+func Session(ctx fiber.Ctx) error {
+	if _, err := validateSession(ctx); err != nil {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(types.Response{
+			Error:   true,
+			Message: err.Error(),
+		})
+	}
+
+	return ctx.Next()
+}
+
 func validateSession(ctx fiber.Ctx, returnName ...bool) (*string, error) {
 	sess, err := sessionStore.Get(ctx)
 	if err != nil {
@@ -15,13 +29,27 @@ func validateSession(ctx fiber.Ctx, returnName ...bool) (*string, error) {
 	}
 	defer sess.Release()
 
-	if _, ok := sess.Get("name").(string); !ok {
+	name, ok := sess.Get("name").(string)
+	if !ok {
 		return nil, errors.New("unauthorized access")
 	}
 
+	// Groups are kept from login, roles are resolved on every request so config changes apply at once
+	var groups []string
+	if joined, _ := sess.Get("groups").(string); joined != "" {
+		groups = strings.Split(joined, ",")
+	}
+
+	routes.SetCaller(ctx, types.Caller{
+		Name:   name,
+		Method: "session",
+		Role:   routes.ResolveRole(name, groups),
+		Groups: groups,
+	})
+
 	ret := sess.ID()
 	if len(returnName) > 0 && returnName[0] {
-		ret = sess.Get("name").(string)
+		ret = name
 	}
 
 	return &ret, nil
@@ -48,6 +76,7 @@ func CheckSession(ctx fiber.Ctx) error {
 		Data: fiber.Map{
 			"username":  name,
 			"s3Enabled": config.Use.S3.Enable,
+			"role":      routes.GetCaller(ctx).Role,
 		},
 	})
 }
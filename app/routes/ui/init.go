@@ -27,11 +27,21 @@ type oauthUserResponse struct {
 	External bool   `json:"external"`
 }
 
+type oauthUserInfoResponse struct {
+	Groups []string `json:"groups"`
+}
+
 func InitOAuth() {
+	scopes := []string{"read_user"}
+	if hasGroupRoles() {
+		// userinfo only lists groups for the openid scope
+		scopes = append(scopes, "openid")
+	}
+
 	oauthConfig = &oauth2.Config{
 		ClientID:     config.Use.Oauth.ClientID,
 		ClientSecret: config.Use.Oauth.ClientSecret,
-		Scopes:       []string{"read_user"},
+		Scopes:       scopes,
 		Endpoint: oauth2.Endpoint{
 			AuthURL:  config.Use.Oauth.BaseURL + "/oauth/authorize",
 			TokenURL: config.Use.Oauth.BaseURL + "/oauth/token",
@@ -39,6 +49,11 @@ func InitOAuth() {
 	}
 }
 
+func hasGroupRoles() bool {
+	groups := config.Use.Roles.Groups
+	return len(groups.Admins) > 0 || len(groups.Editors) > 0 || len(groups.Viewers) > 0
+}
+
 func getOAuthConfig(path string) *oauth2.Config {
 	cfg := *oauthConfig
 	cfg.RedirectURL = config.Use.App.BaseURL + "/auth/gitlab/callback"
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"shorty/app/routes"
 	"shorty/pkg"
 	"shorty/types"
 	"time"
@@ -24,6 +25,9 @@ func SSE(ctx fiber.Ctx) error {
 
 	log.Debug().Str("sessionID", *sessionID).Msg("connected SSE client")
 
+	caller := routes.GetCaller(ctx)
+	all := fiber.Query[bool](ctx, "all")
+
 	// Set headers
 	ctx.Set("Content-Type", "text/event-stream")
 	ctx.Set("Cache-Control", "no-cache")
@@ -48,13 +52,13 @@ func SSE(ctx fiber.Ctx) error {
 		for {
 			select {
 			case <-ticker.C:
-				lists, err := pkg.Redis.GetAll(context.Background())
+				lists, err := pkg.Store.List(context.Background())
 				if err != nil {
 					log.Error().Caller().Err(err).Msg("failed to get data")
 					continue
 				}
 
-				jsonData, err := json.Marshal(lists)
+				jsonData, err := json.Marshal(routes.ScopeToCaller(caller, all, lists))
 				if err != nil {
 					log.Error().Caller().Err(err).Msg("failed to marshal data")
 					continue
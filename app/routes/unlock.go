@@ -0,0 +1,88 @@
+package routes
+
+import (
+	"fmt"
+	"time"
+
+	"shorty/config"
+	"shorty/pkg"
+	"shorty/types"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const passwordAttemptPrefix = "pw_attempt:"
+
+// Unlock checks the password posted from the form rendered by Get
+func Unlock(ctx fiber.Ctx) error {
+	shorturl := ctx.Params("shorty")
+
+	link, err := pkg.Store.Get(ctx.Context(), shorturl)
+	if err != nil {
+		return ctx.SendStatus(fiber.StatusNotFound)
+	}
+
+	if state := link.State(time.Now()); state != types.StateActive {
+		return renderUnavailable(ctx, shorturl, link, state)
+	}
+
+	if _, blocked := pkg.Blocked(link.Url); blocked {
+		return renderBlocked(ctx, shorturl)
+	}
+
+	if link.Password == "" {
+		return redirect(ctx, shorturl, link)
+	}
+
+	// Attempts are counted per link, so guessing from many IPs doesn't help, and before the
+	// comparison, so parallel guesses can't all slip in under the limit
+	attemptKey := passwordAttemptPrefix + shorturl
+	attempts, err := pkg.RedisAuth.Attempt(ctx.Context(), attemptKey, config.Use.Password.Window)
+	if err != nil {
+		return err
+	}
+
+	if attempts > int64(config.Use.Password.MaxAttempts) {
+		ctx.Status(fiber.StatusTooManyRequests)
+		return renderPasswordForm(ctx, shorturl, fmt.Sprintf("Too many wrong attempts, try again in %s", config.Use.Password.Window))
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(link.Password), []byte(ctx.FormValue("password"))); err != nil {
+		ctx.Status(fiber.StatusUnauthorized)
+		return renderPasswordForm(ctx, shorturl, "Wrong password")
+	}
+
+	if err := pkg.RedisAuth.ResetAttempts(ctx.Context(), attemptKey); err != nil {
+		log.Error().Caller().Err(err).Str("shorty", shorturl).Msg("failed to reset password attempts")
+	}
+
+	return redirect(ctx, shorturl, link)
+}
+
+func renderPasswordForm(ctx fiber.Ctx, shorturl, message string) error {
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	return ctx.Render("password", fiber.Map{
+		"Shorty": shorturl,
+		"Error":  message,
+	})
+}
+
+// hashPassword is used on creation, an empty password leaves the link unprotected
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+
+	if len(password) < config.Use.Password.MinLength {
+		return "", fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("password must be at least %d characters", config.Use.Password.MinLength))
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
@@ -0,0 +1,237 @@
+package routes
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"shorty/pkg"
+	"shorty/types"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// Update edits destination, TTL and metadata in place, a new shorty in the body renames it too
+func Update(ctx fiber.Ctx) error {
+	shorturl := ctx.Params("shorty")
+	link, err := pkg.Store.Get(ctx.Context(), shorturl)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+
+	caller := GetCaller(ctx)
+	if !canManage(caller, link) {
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("%s is not yours", shorturl))
+	}
+
+	var patch types.LinkPatch
+	if err := ctx.Bind().Body(&patch); err != nil {
+		return err
+	}
+
+	var newName string
+	if patch.Shorty != "" && patch.Shorty != shorturl {
+		if newName, err = validateAlias(patch.Shorty); err != nil {
+			return err
+		}
+	}
+
+	var ttl time.Duration
+	if patch.Expired != nil {
+		if *patch.Expired < 1 {
+			return fiber.NewError(fiber.StatusBadRequest, "expired must be positive")
+		}
+		ttl = *patch.Expired
+
+		// Uploads are signed for as long as the link lives, the new URL is no new destination
+		if err := presignUpload(ctx, &link, ttl); err != nil {
+			return err
+		}
+	}
+
+	oldUrl := link.Url
+	if patch.Url != nil && *patch.Url != link.Url {
+		if *patch.Url == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "url cannot be empty")
+		}
+
+		if link.Kind == types.KindFile {
+			return fiber.NewError(fiber.StatusBadRequest, "destination of an uploaded file cannot be changed")
+		}
+
+		if err := checkURL(*patch.Url); err != nil {
+			return err
+		}
+
+		link.Url = *patch.Url
+	}
+
+	if patch.Redirect != nil {
+		if *patch.Redirect != "" && !slices.Contains(types.Redirects, *patch.Redirect) {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("redirect must be one of %s", strings.Join(types.Redirects, ", ")))
+		}
+		link.Redirect = *patch.Redirect
+	}
+
+	if patch.Tags != nil {
+		if link.Tags, err = normalizeTags(*patch.Tags); err != nil {
+			return err
+		}
+	}
+
+	if patch.Notes != nil {
+		link.Notes = *patch.Notes
+	}
+
+	if patch.NotBefore != nil {
+		link.NotBefore = patch.NotBefore.UTC()
+	}
+
+	if patch.NotAfter != nil {
+		if link.NotAfter = patch.NotAfter.UTC(); !link.NotAfter.IsZero() && !link.NotAfter.After(time.Now()) {
+			return fiber.NewError(fiber.StatusBadRequest, "not_after must be in the future")
+		}
+	}
+
+	if !link.NotBefore.IsZero() && !link.NotAfter.IsZero() && !link.NotAfter.After(link.NotBefore) {
+		return fiber.NewError(fiber.StatusBadRequest, "not_after must be later than not_before")
+	}
+
+	// A new schedule is checked against the expiry the link keeps, a new expiry against the schedule
+	if patch.Expired != nil || patch.NotBefore != nil || patch.NotAfter != nil {
+		expires := ttl
+		if expires == 0 {
+			if expires, err = pkg.Store.TTL(ctx.Context(), shorturl); err != nil {
+				return err
+			}
+		}
+
+		if _, err := scheduleTTL(link, expires); err != nil {
+			return err
+		}
+	}
+
+	if newName != "" {
+		if _, err := pkg.Store.Get(ctx.Context(), newName); err == nil {
+			return fmt.Errorf("%s %w", newName, pkg.ErrAlreadyExists)
+		}
+	}
+
+	if err := saveLink(ctx, shorturl, link, ttl, oldUrl); err != nil {
+		return err
+	}
+
+	// Rename last, so a rejected patch never leaves the link under its new name
+	if newName != "" {
+		if err := rename(ctx, shorturl, newName); err != nil {
+			return err
+		}
+		shorturl = newName
+	}
+
+	if link.Url != oldUrl && !patch.SkipCheck {
+		pkg.ValidateAsync(shorturl, link.Url)
+	}
+
+	audit(ctx, types.ActionUpdate, shorturl, oldUrl, link.Url)
+
+	return ctx.JSON(types.Response{
+		Error:   false,
+		Message: fmt.Sprintf("%s updated", shorturl),
+	})
+}
+
+// History lists the previous destinations of a link, newest first
+func History(ctx fiber.Ctx) error {
+	shorturl := ctx.Params("shorty")
+	link, err := pkg.Store.Get(ctx.Context(), shorturl)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+
+	if !canManage(GetCaller(ctx), link) {
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("%s is not yours", shorturl))
+	}
+
+	history, err := pkg.Store.History(ctx.Context(), shorturl)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(types.Response{
+		Error: false,
+		Data:  history,
+	})
+}
+
+// Revert points a link back to a previous destination, ?to= is its index in History
+func Revert(ctx fiber.Ctx) error {
+	shorturl := ctx.Params("shorty")
+	link, err := pkg.Store.Get(ctx.Context(), shorturl)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+
+	if !canManage(GetCaller(ctx), link) {
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("%s is not yours", shorturl))
+	}
+
+	history, err := pkg.Store.History(ctx.Context(), shorturl)
+	if err != nil {
+		return err
+	}
+
+	to := fiber.Query[int](ctx, "to")
+	if to < 0 || to >= len(history) {
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("%s has no revision %d", shorturl, to))
+	}
+
+	// The old destination may have been blocklisted or gone down since
+	if err := checkURL(history[to].Url); err != nil {
+		return err
+	}
+
+	// Reverting is a change of its own, so the current destination goes into history as well
+	oldUrl := link.Url
+	link.Url = history[to].Url
+	if err := saveLink(ctx, shorturl, link, 0, oldUrl); err != nil {
+		return err
+	}
+
+	pkg.ValidateAsync(shorturl, link.Url)
+
+	audit(ctx, types.ActionRevert, shorturl, oldUrl, link.Url)
+
+	return ctx.JSON(types.Response{
+		Error:   false,
+		Message: fmt.Sprintf("%s reverted to %s", shorturl, link.Url),
+	})
+}
+
+// saveLink writes an edited link, recording oldUrl in history when the destination moved
+func saveLink(ctx fiber.Ctx, shorturl string, link types.Link, ttl time.Duration, oldUrl string) error {
+	now := time.Now().UTC()
+	link.UpdatedAt = now
+
+	var rev *types.Revision
+	if link.Url != oldUrl {
+		rev = &types.Revision{
+			Url:       oldUrl,
+			ChangedAt: now,
+			ChangedBy: GetCaller(ctx).Name,
+		}
+	}
+
+	if err := pkg.Store.Update(ctx.Context(), shorturl, link, ttl, rev); err != nil {
+		return err
+	}
+
+	if err := pkg.Analytics.Expire(ctx.Context(), shorturl, ttl); err != nil {
+		log.Warn().Err(err).Str("shorty", shorturl).Msg("failed to expire stats")
+	}
+
+	pkg.IndexLink(ctx.Context(), shorturl, link)
+	return nil
+}
@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"fmt"
+	"net/url"
+	"runtime"
+	"strconv"
+	"time"
+
+	"shorty/config"
+	"shorty/pkg"
+	"shorty/types"
+	"shorty/utils"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
+)
+
+func Upload(ctx fiber.Ctx) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Context().Done():
+			// Client disconnected/cancelled - clean up
+			log.Info().Msg("upload cancelled")
+			// Clean up any partial uploads
+			slugifiedName := utils.SlugifyFilename(ctx.FormValue("file"))
+			if err := utils.Storage.Delete(slugifiedName); err != nil {
+				log.Warn().Err(err).Msg("failed to cleanup cancelled upload")
+			}
+		case <-done:
+			// Normal completion - do nothing
+			return
+		}
+	}()
+
+	var maxClicks int64
+	if value := ctx.FormValue("max_clicks"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "max_clicks must be a positive number")
+		}
+		maxClicks = n
+	}
+
+	file, err := ctx.FormFile("file")
+	if err != nil {
+		log.Error().Caller().Err(err).Send()
+		return ctx.Status(fiber.StatusBadRequest).JSON(types.Response{
+			Error:   true,
+			Message: "Invalid file upload: " + err.Error(),
+		})
+	}
+
+	slugifiedName := utils.SlugifyFilename(file.Filename)
+	select {
+	case <-ctx.Context().Done():
+		return ctx.Status(fiber.StatusRequestTimeout).JSON(types.Response{
+			Error:   true,
+			Message: "Upload cancelled",
+		})
+	default:
+		if err := ctx.SaveFileToStorage(file, slugifiedName, utils.Storage); err != nil {
+			log.Error().Caller().Err(err).Send()
+			return fmt.Errorf("failed save file to storage: %v", err)
+		}
+	}
+
+	url, _, err := presignObject(ctx, slugifiedName, config.Use.S3.Expired)
+	if err != nil {
+		log.Error().Caller().Err(err).Send()
+		return fmt.Errorf("failed to get presigned url: %v", err)
+	}
+
+	link := pkg.NewLink(url)
+	link.Kind = types.KindFile
+	link.Object = slugifiedName
+	link.MaxClicks = maxClicks
+	link.Owner = GetCaller(ctx).Name
+
+	if link.Password, err = hashPassword(ctx.FormValue("password")); err != nil {
+		return err
+	}
+
+	shorty, err := createLink(ctx, "", "", 0, link, types.S3Credentials{}, config.Use.S3.Expired)
+	if err != nil {
+		log.Error().Caller().Err(err).Send()
+		return fmt.Errorf("failed to set redis key: %v", err)
+	}
+
+	audit(ctx, types.ActionUpload, shorty, "", slugifiedName)
+
+	// Aggresively freeing memory
+	runtime.GC()
+
+	return ctx.JSON(types.Response{
+		Error:   false,
+		Message: fmt.Sprintf("%s/%s", ctx.BaseURL(), shorty),
+	})
+}
+
+// maxPresignExpiry is the longest S3 lets a presigned URL live
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// presignObject signs an uploaded object for as long as the link lives, ttl < 0 never expires
+func presignObject(ctx fiber.Ctx, objectName string, ttl time.Duration) (string, time.Duration, error) {
+	expiry := maxPresignExpiry
+	if ttl > 0 {
+		expiry = min(ttl, maxPresignExpiry)
+	}
+
+	reqParams := make(url.Values)
+	reqParams.Set("response-content-disposition", "inline")
+	presigned, err := utils.Storage.Conn().PresignedGetObject(ctx.Context(), config.Use.S3.Bucket, objectName, expiry, reqParams)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return presigned.String(), expiry, nil
+}
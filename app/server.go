@@ -3,6 +3,7 @@ package app
 import (
 	"errors"
 	"shorty/config"
+	"shorty/pkg"
 	"shorty/types"
 	"time"
 
@@ -58,6 +59,7 @@ func RunServer() (app *fiber.App, err error) {
 		AllowOrigins:     []string{config.Use.App.BaseURL},
 		AllowHeaders:     []string{"Origin, Content-Type, Accept, Authorization, Cache-Control"},
 		AllowCredentials: true,
+		ExposeHeaders:    []string{"X-Total-Count", "X-Next-Cursor"},
 		MaxAge:           300,
 	}))
 	app.Use(favicon.New())
@@ -98,9 +100,16 @@ func RunServer() (app *fiber.App, err error) {
 
 func errHandler(c fiber.Ctx, err error) error {
 	code := fiber.StatusInternalServerError
+	var data any
 	var e *fiber.Error
+	var ue *pkg.URLError
 	if errors.As(err, &e) {
 		code = e.Code
+	} else if errors.As(err, &ue) {
+		code = fiber.StatusUnprocessableEntity
+		data = ue
+	} else if errors.Is(err, pkg.ErrAlreadyExists) {
+		code = fiber.StatusConflict
 	}
 
 	ua := c.Get(fiber.HeaderUserAgent)
@@ -115,5 +124,6 @@ func errHandler(c fiber.Ctx, err error) error {
 	return c.Status(code).JSON(types.Response{
 		Error:   true,
 		Message: err.Error(),
+		Data:    data,
 	})
 }
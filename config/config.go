@@ -27,16 +27,119 @@ type config struct {
 		BaseURL string `yaml:"base_url" env:"BASE_URL" env-default:"https://u.nusatek.dev"`
 	} `yaml:"app"`
 
+	// Roles are granted by username or GitLab group full path, the highest match wins
+	Roles struct {
+		Default string   `yaml:"default" env:"ROLE_DEFAULT" env-default:"editor"`
+		All     string   `yaml:"all" env:"ROLE_ALL" env-default:"admin"` // lowest role that may see everyone's links with all
+		Admins  []string `yaml:"admins" env:"ADMINS" env-separator:","`
+		Editors []string `yaml:"editors" env:"EDITORS" env-separator:","`
+		Viewers []string `yaml:"viewers" env:"VIEWERS" env-separator:","`
+		Groups  struct {
+			Admins  []string `yaml:"admins" env:"ADMIN_GROUPS" env-separator:","`
+			Editors []string `yaml:"editors" env:"EDITOR_GROUPS" env-separator:","`
+			Viewers []string `yaml:"viewers" env:"VIEWER_GROUPS" env-separator:","`
+		} `yaml:"groups"`
+	} `yaml:"roles"`
+
+	Generator struct {
+		Mode      string   `yaml:"mode" env:"GENERATOR_MODE" env-default:"pronounceable"` // pronounceable, base62, sequential or words
+		Length    int      `yaml:"length" env:"GENERATOR_LENGTH" env-default:"8"`
+		MaxLength int      `yaml:"max_length" env:"GENERATOR_MAX_LENGTH" env-default:"16"`
+		Alphabet  string   `yaml:"alphabet" env:"GENERATOR_ALPHABET"` // shuffled alphabet for the sequential mode
+		Blocklist []string `yaml:"blocklist" env:"GENERATOR_BLOCKLIST" env-separator:","`
+	} `yaml:"generator"`
+
+	Alias struct {
+		MinLength int `yaml:"min_length" env:"ALIAS_MIN_LENGTH" env-default:"3"`
+		MaxLength int `yaml:"max_length" env:"ALIAS_MAX_LENGTH" env-default:"64"`
+	} `yaml:"alias"`
+
+	Password struct {
+		MinLength   int           `yaml:"min_length" env:"PASSWORD_MIN_LENGTH" env-default:"6"`
+		MaxAttempts int           `yaml:"max_attempts" env:"PASSWORD_MAX_ATTEMPTS" env-default:"5"`
+		Window      time.Duration `yaml:"window" env:"PASSWORD_WINDOW" env-default:"15m"`
+	} `yaml:"password"`
+
+	TTL struct {
+		Default time.Duration `yaml:"default" env:"TTL_DEFAULT" env-default:"30m"` // used when a link is created without one, 0 never expires
+	} `yaml:"ttl"`
+
+	History struct {
+		Max int64 `yaml:"max" env:"HISTORY_MAX" env-default:"20"` // previous destinations kept per link
+	} `yaml:"history"`
+
+	Validate struct {
+		Enable       bool          `yaml:"enable" env:"VALIDATE_ENABLE" env-default:"true"` // check that destinations answer before linking them
+		Timeout      time.Duration `yaml:"timeout" env:"VALIDATE_TIMEOUT" env-default:"5s"` // for the whole probe and for each dial
+		MaxRedirects int           `yaml:"max_redirects" env:"VALIDATE_MAX_REDIRECTS" env-default:"5"`
+		Schemes      []string      `yaml:"schemes" env:"VALIDATE_SCHEMES" env-separator:"," env-default:"http,https"`
+		AllowPrivate bool          `yaml:"allow_private" env:"VALIDATE_ALLOW_PRIVATE"` // private, loopback and link-local destinations
+	} `yaml:"validate"`
+
+	Blocklist struct {
+		Files    []string      `yaml:"files" env:"BLOCKLIST_FILES" env-separator:","`           // hosts files, domain or url lists and /regex/ lists
+		Local    string        `yaml:"local" env:"BLOCKLIST_LOCAL" env-default:"blocklist.txt"` // entries managed through the API
+		Interval time.Duration `yaml:"interval" env:"BLOCKLIST_INTERVAL" env-default:"1m"`      // how often files are checked for changes, 0 disables
+		Template string        `yaml:"template" env:"BLOCKLIST_TEMPLATE" env-default:"blocked"` // warning page under ui/
+	} `yaml:"blocklist"`
+
+	Health struct {
+		Interval time.Duration `yaml:"interval" env:"HEALTH_INTERVAL" env-default:"6h"` // how often destinations are checked, 0 disables
+		Workers  int           `yaml:"workers" env:"HEALTH_WORKERS" env-default:"4"`
+		Timeout  time.Duration `yaml:"timeout" env:"HEALTH_TIMEOUT" env-default:"10s"`
+	} `yaml:"health"`
+
+	Batch struct {
+		MaxItems int `yaml:"max_items" env:"BATCH_MAX_ITEMS" env-default:"100"`
+		Workers  int `yaml:"workers" env:"BATCH_WORKERS" env-default:"8"` // concurrent destination checks
+	} `yaml:"batch"`
+
+	Redirect struct {
+		MaxAge       time.Duration `yaml:"max_age" env:"REDIRECT_MAX_AGE" env-default:"24h"` // upper bound of Cache-Control max-age, only links marked 301 or 308 are cached
+		RefreshDelay time.Duration `yaml:"refresh_delay" env:"REDIRECT_REFRESH_DELAY" env-default:"3s"`
+	} `yaml:"redirect"`
+
+	// Schedule controls what visitors see before a link's not_before
+	Schedule struct {
+		PendingTemplate string `yaml:"pending_template" env:"SCHEDULE_PENDING_TEMPLATE" env-default:"pending"` // template under ui/
+		PendingMessage  string `yaml:"pending_message" env:"SCHEDULE_PENDING_MESSAGE" env-default:"This link is not available yet."`
+	} `yaml:"schedule"`
+
+	Store struct {
+		Driver        string        `yaml:"driver" env:"STORE_DRIVER" env-default:"redis"` // redis or bolt, redis is still required for auth
+		Path          string        `yaml:"path" env:"STORE_PATH" env-default:"shorty.db"`
+		SweepInterval time.Duration `yaml:"sweep_interval" env:"STORE_SWEEP_INTERVAL" env-default:"5m"` // bolt only, how often expired links are purged
+	} `yaml:"store"`
+
 	Redis struct {
 		Host     string `yaml:"host" env:"REDIS_HOST" env-default:"127.0.0.1"`
 		Port     string `yaml:"port" env:"REDIS_PORT" env-default:"6379"`
 		Password string `yaml:"password" env:"REDIS_PASSWORD"`
 		DB       struct {
-			Main int `yaml:"main" env:"REDIS_DB" env-default:"0"`
-			Auth int `yaml:"auth" env:"REDIS_DB_AUTH" env-default:"1"`
+			Main  int `yaml:"main" env:"REDIS_DB" env-default:"0"`
+			Auth  int `yaml:"auth" env:"REDIS_DB_AUTH" env-default:"1"`
+			Stats int `yaml:"stats" env:"REDIS_DB_STATS" env-default:"3"`
 		} `yaml:"db"`
 	} `yaml:"redis"`
 
+	Search struct {
+		Driver string `yaml:"driver" env:"SEARCH_DRIVER" env-default:"auto"` // auto, redisearch, memory or none, redisearch needs links in redis DB 0
+	} `yaml:"search"`
+
+	Analytics struct {
+		Enable        bool          `yaml:"enable" env:"ANALYTICS_ENABLE" env-default:"true"`
+		QueueSize     int           `yaml:"queue_size" env:"ANALYTICS_QUEUE_SIZE" env-default:"4096"`
+		BatchSize     int           `yaml:"batch_size" env:"ANALYTICS_BATCH_SIZE" env-default:"256"`
+		FlushInterval time.Duration `yaml:"flush_interval" env:"ANALYTICS_FLUSH_INTERVAL" env-default:"5s"`
+		HourRetention time.Duration `yaml:"hour_retention" env:"ANALYTICS_HOUR_RETENTION" env-default:"168h"`
+	} `yaml:"analytics"`
+
+	Audit struct {
+		Driver string `yaml:"driver" env:"AUDIT_DRIVER" env-default:"redis"` // redis, file or none
+		Path   string `yaml:"path" env:"AUDIT_PATH" env-default:"audit.log"`
+		MaxLen int64  `yaml:"max_len" env:"AUDIT_MAX_LEN" env-default:"0"` // approximate cap of the redis stream, 0 keeps everything
+	} `yaml:"audit"`
+
 	Oauth struct {
 		ClientID     string `yaml:"client_id" env:"OAUTH_CLIENT_ID"`
 		ClientSecret string `yaml:"client_secret" env:"OAUTH_CLIENT_SECRET"`
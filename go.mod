@@ -14,7 +14,9 @@ require (
 	github.com/minio/minio-go/v7 v7.0.94
 	github.com/redis/go-redis/v9 v9.10.0
 	github.com/rs/zerolog v1.34.0
+	github.com/sqids/sqids-go v0.4.1
 	github.com/zeebo/blake3 v0.2.4
+	go.etcd.io/bbolt v1.4.0
 	golang.org/x/crypto v0.39.0
 	golang.org/x/oauth2 v0.30.0
 )
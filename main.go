@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"io"
 	"os"
 	"os/signal"
@@ -45,26 +46,71 @@ func main() {
 
 	log.Logger = zerolog.New(writeLog).With().Timestamp().Logger()
 
+	// Open Redis connection for auth DB, tokens, password attempts and sessions live there
+	// whichever driver stores the links
+	var err error
+	pkg.RedisAuth, err = pkg.NewRedis(config.Use.Redis.DB.Auth)
+	if err != nil {
+		log.Fatal().Err(err).Str("store", config.Use.Store.Driver).Msg("redis is required for API tokens, sessions and password attempts, also with the bolt store")
+	}
+
 	// Run server
 	server, err := app.RunServer()
 	if err != nil {
 		log.Error().Err(err).Send()
 	}
 
-	// Open Redis connection for every DB
-	pkg.Redis, err = pkg.NewRedis()
+	// Open link store (redis or embedded bolt)
+	pkg.Store, err = pkg.NewLinkStore()
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+
+	// Upgrade links stored as bare URL strings into records
+	if upgraded, err := pkg.Store.Migrate(context.Background()); err != nil {
+		log.Error().Err(err).Msg("failed to migrate links")
+	} else if upgraded > 0 {
+		log.Info().Int("links", upgraded).Msg("migrated links to versioned records")
+	}
+
+	// Run cleanup of expired entries and of objects for expired shorty
+	pkg.Store.StartCleanupScheduler()
+
+	// Re-check destinations of url links in the background
+	if config.Use.Health.Interval > 0 {
+		pkg.StartHealthChecker()
+	}
+
+	// Audit trail of mutating operations
+	pkg.Audit, err = pkg.NewAuditLog()
 	if err != nil {
 		log.Error().Err(err).Send()
 	}
 
-	// Run cleanup objects for expired shorty
-	if config.Use.S3.Enable && config.Use.S3.CleanupInterval > 0 {
-		pkg.Redis.StartCleanupScheduler()
+	// Search index over shorty and destination
+	pkg.Search, err = pkg.NewSearchIndex(context.Background())
+	if err != nil {
+		log.Error().Err(err).Send()
+	} else if indexed, err := pkg.Reindex(context.Background()); err != nil {
+		log.Error().Err(err).Msg("failed to build search index")
+	} else {
+		log.Debug().Int("links", indexed).Msg("built search index")
 	}
 
-	pkg.RedisAuth, err = pkg.NewRedis(config.Use.Redis.DB.Auth)
+	// Blocklist of malicious destinations
+	pkg.Blocklist, err = pkg.NewBlocklist()
 	if err != nil {
 		log.Error().Err(err).Send()
+	} else if config.Use.Blocklist.Interval > 0 {
+		pkg.Blocklist.StartReloader()
+	}
+
+	// Batch writer for click analytics
+	if config.Use.Analytics.Enable {
+		pkg.Analytics, err = pkg.NewAnalytics()
+		if err != nil {
+			log.Error().Err(err).Send()
+		}
 	}
 
 	defer func() {
@@ -75,8 +121,15 @@ func main() {
 		}
 
 		// Close redis connection
-		pkg.Redis.Close()
+		pkg.Store.Close()
 		pkg.RedisAuth.Close()
+		pkg.Analytics.Close()
+		if pkg.Audit != nil {
+			pkg.Audit.Close()
+		}
+		if pkg.Search != nil {
+			pkg.Search.Close()
+		}
 	}()
 
 	// Handle graceful shutdown
@@ -0,0 +1,483 @@
+package pkg
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"shorty/config"
+	"shorty/types"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"github.com/zeebo/blake3"
+)
+
+const (
+	statsTotalPrefix   = "stats_total:"
+	statsUniquePrefix  = "stats_unique:"
+	statsHourPrefix    = "stats_hour:"
+	statsDayPrefix     = "stats_day:"
+	statsRefPrefix     = "stats_ref:"
+	statsAgentPrefix   = "stats_agent:"
+	statsCountryPrefix = "stats_country:"
+
+	statsDayLayout = "20060102"
+)
+
+// Click is a single redirect served by routes.Get
+type Click struct {
+	Shorty   string
+	Time     time.Time
+	Referrer string
+	Agent    string
+	Country  string
+	IPHash   string
+	Expires  time.Time // when the link runs out, its stats go with it, zero for links that never expire
+}
+
+type analytics struct {
+	rdb   *redis
+	queue chan Click
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+var Analytics *analytics
+
+// NewAnalytics opens the stats database and starts the background batch writer
+func NewAnalytics() (*analytics, error) {
+	rdb, err := NewRedis(config.Use.Redis.DB.Stats)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &analytics{
+		rdb:   rdb,
+		queue: make(chan Click, max(config.Use.Analytics.QueueSize, 1)),
+		done:  make(chan struct{}),
+	}
+
+	a.wg.Add(1)
+	go a.run()
+
+	return a, nil
+}
+
+// NewClick builds a click from raw request values, hashing the IP so it is never stored in clear
+func NewClick(shorty, referer, userAgent, country, ip string, expires time.Time) Click {
+	return Click{
+		Shorty:   shorty,
+		Time:     time.Now().UTC(),
+		Referrer: referrerHost(referer),
+		Agent:    agentClass(userAgent),
+		Country:  strings.ToUpper(country),
+		IPHash:   hashIP(ip),
+		Expires:  expires,
+	}
+}
+
+// Record queues a click without blocking; clicks are dropped when the queue is full
+func (a *analytics) Record(click Click) {
+	if a == nil {
+		return
+	}
+
+	select {
+	case a.queue <- click:
+	default:
+		log.Warn().Str("shorty", click.Shorty).Msg("analytics queue full, dropping click")
+	}
+}
+
+// Close flushes pending clicks and closes the stats database
+func (a *analytics) Close() {
+	if a == nil {
+		return
+	}
+
+	close(a.done)
+	a.wg.Wait()
+	a.rdb.Close()
+}
+
+func (a *analytics) run() {
+	defer a.wg.Done()
+
+	batchSize := max(config.Use.Analytics.BatchSize, 1)
+	interval := config.Use.Analytics.FlushInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make([]Click, 0, batchSize)
+	for {
+		select {
+		case click := <-a.queue:
+			batch = append(batch, click)
+			if len(batch) >= batchSize {
+				a.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				a.flush(batch)
+				batch = batch[:0]
+			}
+		case <-a.done:
+			// Drain whatever is still queued before exiting
+			for {
+				select {
+				case click := <-a.queue:
+					batch = append(batch, click)
+				default:
+					if len(batch) > 0 {
+						a.flush(batch)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *analytics) flush(batch []Click) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Aggregate in memory first so a burst on one shorty becomes a single increment
+	counters := make(map[string]map[string]int64)
+	incr := func(key, field string) {
+		if counters[key] == nil {
+			counters[key] = make(map[string]int64)
+		}
+		counters[key][field]++
+	}
+
+	uniques := make(map[string][]any)
+	hourKeys := make(map[string]string)
+	expires := make(map[string]time.Time)
+	for _, click := range batch {
+		incr(statsTotalPrefix+click.Shorty, "")
+		expires[click.Shorty] = click.Expires
+
+		hourKey := statsHourPrefix + click.Shorty + ":" + click.Time.Format(statsDayLayout)
+		hourKeys[hourKey] = click.Shorty
+		incr(hourKey, click.Time.Format("15"))
+		incr(statsDayPrefix+click.Shorty, click.Time.Format(statsDayLayout))
+		incr(statsRefPrefix+click.Shorty, click.Referrer)
+		incr(statsAgentPrefix+click.Shorty, click.Agent)
+		if click.Country != "" {
+			incr(statsCountryPrefix+click.Shorty, click.Country)
+		}
+
+		if click.IPHash != "" {
+			uniques[click.Shorty] = append(uniques[click.Shorty], click.IPHash)
+		}
+	}
+
+	pipe := a.rdb.client.Pipeline()
+	for key, fields := range counters {
+		for field, count := range fields {
+			switch {
+			case strings.HasPrefix(key, statsTotalPrefix):
+				pipe.IncrBy(ctx, key, count)
+			case strings.HasPrefix(key, statsHourPrefix), strings.HasPrefix(key, statsDayPrefix):
+				pipe.HIncrBy(ctx, key, field, count)
+			default:
+				pipe.ZIncrBy(ctx, key, float64(count), field)
+			}
+		}
+	}
+
+	for shorty, hashes := range uniques {
+		pipe.PFAdd(ctx, statsUniquePrefix+shorty, hashes...)
+	}
+
+	// Stats expire with their link, hour buckets earlier when their retention runs out first
+	for key, shorty := range hourKeys {
+		retention := config.Use.Analytics.HourRetention
+		if at := expires[shorty]; !at.IsZero() {
+			retention = min(retention, time.Until(at))
+		}
+		pipe.Expire(ctx, key, max(retention, time.Second))
+	}
+
+	for shorty, at := range expires {
+		if at.IsZero() {
+			continue
+		}
+
+		for _, key := range statsKeys(shorty) {
+			pipe.PExpireAt(ctx, key, at)
+		}
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Error().Caller().Err(err).Int("clicks", len(batch)).Msg("failed to flush analytics")
+	}
+}
+
+// Stats returns the time series and top counters for a shorty
+func (a *analytics) Stats(ctx context.Context, shorty string, hours, days int, top int64) (types.Stats, error) {
+	stats := types.Stats{Shorty: shorty}
+
+	total, err := a.rdb.client.Get(ctx, statsTotalPrefix+shorty).Int64()
+	if err != nil && err != goredis.Nil {
+		return stats, err
+	}
+	stats.Total = total
+
+	if stats.Unique, err = a.rdb.client.PFCount(ctx, statsUniquePrefix+shorty).Result(); err != nil {
+		return stats, err
+	}
+
+	now := time.Now().UTC()
+
+	// Hour buckets are split per day so each day can expire on its own
+	hourly := make(map[string]map[string]string)
+	for i := hours - 1; i >= 0; i-- {
+		t := now.Add(-time.Duration(i) * time.Hour).Truncate(time.Hour)
+		day := t.Format(statsDayLayout)
+		if _, ok := hourly[day]; !ok {
+			if hourly[day], err = a.rdb.client.HGetAll(ctx, statsHourPrefix+shorty+":"+day).Result(); err != nil {
+				return stats, err
+			}
+		}
+
+		stats.Hourly = append(stats.Hourly, types.StatsBucket{
+			Time:  t,
+			Count: parseCount(hourly[day][t.Format("15")]),
+		})
+	}
+
+	daily, err := a.rdb.client.HGetAll(ctx, statsDayPrefix+shorty).Result()
+	if err != nil {
+		return stats, err
+	}
+
+	today := now.Truncate(24 * time.Hour)
+	for i := days - 1; i >= 0; i-- {
+		t := today.AddDate(0, 0, -i)
+		stats.Daily = append(stats.Daily, types.StatsBucket{
+			Time:  t,
+			Count: parseCount(daily[t.Format(statsDayLayout)]),
+		})
+	}
+
+	if stats.Referrers, err = a.topCounters(ctx, statsRefPrefix+shorty, top); err != nil {
+		return stats, err
+	}
+
+	if stats.Agents, err = a.topCounters(ctx, statsAgentPrefix+shorty, top); err != nil {
+		return stats, err
+	}
+
+	if stats.Countries, err = a.topCounters(ctx, statsCountryPrefix+shorty, top); err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+func (a *analytics) topCounters(ctx context.Context, key string, top int64) ([]types.StatsCounter, error) {
+	members, err := a.rdb.client.ZRevRangeWithScores(ctx, key, 0, top-1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	counters := make([]types.StatsCounter, 0, len(members))
+	for _, m := range members {
+		counters = append(counters, types.StatsCounter{
+			Name:  m.Member.(string),
+			Count: int64(m.Score),
+		})
+	}
+
+	return counters, nil
+}
+
+// statsKeys are the keys of a shorty that live as long as its link, hour buckets aside
+func statsKeys(shorty string) []string {
+	return []string{
+		statsTotalPrefix + shorty,
+		statsUniquePrefix + shorty,
+		statsDayPrefix + shorty,
+		statsRefPrefix + shorty,
+		statsAgentPrefix + shorty,
+		statsCountryPrefix + shorty,
+	}
+}
+
+// hourKeys returns the hour buckets of a shorty, one per day with clicks
+func (a *analytics) hourKeys(ctx context.Context, shorty string) ([]string, error) {
+	var keys []string
+	iter := a.rdb.client.Scan(ctx, 0, statsHourPrefix+shorty+":*", 0).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+
+	return keys, iter.Err()
+}
+
+// Purge removes all stats of a shorty, used when the link itself is deleted or its shorty
+// is taken again
+func (a *analytics) Purge(ctx context.Context, shorty string) error {
+	if a == nil {
+		return nil
+	}
+
+	hours, err := a.hourKeys(ctx, shorty)
+	if err != nil {
+		return err
+	}
+
+	return a.rdb.client.Del(ctx, append(statsKeys(shorty), hours...)...).Err()
+}
+
+// Expire follows a ttl change of the link, with the store's meaning: 0 keeps the current expiry
+// and NoExpiry removes it. Hour buckets keep their own retention when that runs out first.
+func (a *analytics) Expire(ctx context.Context, shorty string, ttl time.Duration) error {
+	if a == nil || ttl == 0 {
+		return nil
+	}
+
+	pipe := a.rdb.client.Pipeline()
+	for _, key := range statsKeys(shorty) {
+		if ttl < 0 {
+			pipe.Persist(ctx, key)
+		} else {
+			pipe.PExpire(ctx, key, ttl)
+		}
+	}
+
+	if ttl > 0 {
+		hours, err := a.hourKeys(ctx, shorty)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range hours {
+			pipe.ExpireLT(ctx, key, ttl)
+		}
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// renameStatsScript moves every stats key in one go and only when none of the destinations
+// exists, so the stats of another link are never overwritten. KEYS are source and destination
+// pairs, missing sources are skipped.
+var renameStatsScript = goredis.NewScript(`
+for i = 2, #KEYS, 2 do
+	if redis.call("EXISTS", KEYS[i]) == 1 then
+		return 0
+	end
+end
+for i = 1, #KEYS, 2 do
+	if redis.call("EXISTS", KEYS[i]) == 1 then
+		redis.call("RENAME", KEYS[i], KEYS[i + 1])
+	end
+end
+return 1
+`)
+
+// Rename moves the stats of a shorty along with the link
+func (a *analytics) Rename(ctx context.Context, oldShorty, newShorty string) error {
+	if a == nil {
+		return nil
+	}
+
+	var keys []string
+	for _, key := range statsKeys(oldShorty) {
+		keys = append(keys, key, strings.TrimSuffix(key, oldShorty)+newShorty)
+	}
+
+	hours, err := a.hourKeys(ctx, oldShorty)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range hours {
+		keys = append(keys, key, statsHourPrefix+newShorty+strings.TrimPrefix(key, statsHourPrefix+oldShorty))
+	}
+
+	// Hour buckets of the destination are only found by scanning, they count as a collision too
+	if taken, err := a.hourKeys(ctx, newShorty); err != nil {
+		return err
+	} else if len(taken) > 0 {
+		return fmt.Errorf("stats of %s already exist", newShorty)
+	}
+
+	moved, err := renameStatsScript.Run(ctx, a.rdb.client, keys).Int()
+	if err != nil {
+		return err
+	}
+
+	if moved == 0 {
+		return fmt.Errorf("stats of %s already exist", newShorty)
+	}
+
+	return nil
+}
+
+func parseCount(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+func referrerHost(referer string) string {
+	if referer == "" {
+		return "direct"
+	}
+
+	u, err := url.Parse(referer)
+	if err != nil || u.Hostname() == "" {
+		return "unknown"
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+func agentClass(ua string) string {
+	ua = strings.ToLower(ua)
+
+	switch {
+	case ua == "":
+		return "unknown"
+	case strings.Contains(ua, "bot"), strings.Contains(ua, "spider"), strings.Contains(ua, "crawl"), strings.Contains(ua, "preview"):
+		return "bot"
+	case strings.HasPrefix(ua, "curl"), strings.HasPrefix(ua, "wget"), strings.HasPrefix(ua, "httpie"), strings.Contains(ua, "python"), strings.HasPrefix(ua, "go-http-client"):
+		return "cli"
+	case strings.Contains(ua, "ipad"), strings.Contains(ua, "tablet"):
+		return "tablet"
+	case strings.Contains(ua, "mobi"), strings.Contains(ua, "android"), strings.Contains(ua, "iphone"):
+		return "mobile"
+	case strings.Contains(ua, "mozilla"):
+		return "desktop"
+	default:
+		return "other"
+	}
+}
+
+func hashIP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+
+	// Salt with the app key so hashes can't be reversed with a simple IPv4 table
+	h := blake3.New()
+	_, _ = h.Write([]byte(config.Use.App.Key))
+	_, _ = h.Write([]byte(ip))
+
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
@@ -0,0 +1,202 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"shorty/config"
+	"shorty/types"
+	"shorty/utils"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	auditStream    = "audit"
+	auditPageSize  = 500
+	auditMaxResult = 1000
+)
+
+// AuditLog is an append-only trail of every mutating operation
+type AuditLog interface {
+	Write(ctx context.Context, entry types.AuditEntry) error
+	Query(ctx context.Context, filter types.AuditFilter) ([]types.AuditEntry, error)
+	Close()
+}
+
+var Audit AuditLog
+
+// NewAuditLog opens the backend selected by audit.driver, "none" disables auditing
+func NewAuditLog() (AuditLog, error) {
+	switch config.Use.Audit.Driver {
+	case "", "redis":
+		rdb, err := NewRedis(config.Use.Redis.DB.Auth)
+		if err != nil {
+			return nil, err
+		}
+		return &redisAudit{rdb: rdb}, nil
+	case "file":
+		f, err := os.OpenFile(config.Use.Audit.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		return &fileAudit{file: f}, nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown audit driver %q", config.Use.Audit.Driver)
+	}
+}
+
+func limitOf(filter types.AuditFilter) int {
+	if filter.Limit < 1 || filter.Limit > auditMaxResult {
+		return auditMaxResult
+	}
+
+	return filter.Limit
+}
+
+// redisAudit keeps entries in a stream, its IDs double as millisecond timestamps
+type redisAudit struct {
+	rdb *redis
+}
+
+func (a *redisAudit) Write(ctx context.Context, entry types.AuditEntry) error {
+	args := &goredis.XAddArgs{
+		Stream: auditStream,
+		Values: map[string]any{"entry": utils.ToJSON(entry)},
+	}
+
+	if config.Use.Audit.MaxLen > 0 {
+		args.MaxLen = config.Use.Audit.MaxLen
+		args.Approx = true
+	}
+
+	return a.rdb.client.XAdd(ctx, args).Err()
+}
+
+func (a *redisAudit) Query(ctx context.Context, filter types.AuditFilter) ([]types.AuditEntry, error) {
+	limit := limitOf(filter)
+
+	start, stop := "+", "-"
+	if !filter.To.IsZero() {
+		start = strconv.FormatInt(filter.To.UnixMilli(), 10)
+	}
+	if !filter.From.IsZero() {
+		stop = strconv.FormatInt(filter.From.UnixMilli(), 10)
+	}
+
+	var entries []types.AuditEntry
+	for len(entries) < limit {
+		messages, err := a.rdb.client.XRevRangeN(ctx, auditStream, start, stop, auditPageSize).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range messages {
+			raw, _ := msg.Values["entry"].(string)
+
+			var entry types.AuditEntry
+			if err := utils.FromJSON([]byte(raw), &entry); err != nil {
+				continue
+			}
+			entry.ID = msg.ID
+
+			if filter.Match(entry) {
+				entries = append(entries, entry)
+				if len(entries) == limit {
+					break
+				}
+			}
+		}
+
+		if len(messages) < auditPageSize {
+			break
+		}
+
+		// Continue right before the oldest message of this page
+		start = "(" + messages[len(messages)-1].ID
+	}
+
+	return entries, nil
+}
+
+func (a *redisAudit) Close() {
+	a.rdb.Close()
+}
+
+// fileAudit appends one JSON entry per line
+type fileAudit struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func (a *fileAudit) Write(ctx context.Context, entry types.AuditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if entry.ID == "" {
+		entry.ID = strconv.FormatInt(entry.Time.UnixNano(), 10)
+	}
+
+	_, err := a.file.Write(append(utils.ToJSON(entry), '\n'))
+	return err
+}
+
+func (a *fileAudit) Query(ctx context.Context, filter types.AuditFilter) ([]types.AuditEntry, error) {
+	f, err := os.Open(config.Use.Audit.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []types.AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry types.AuditEntry
+		if err := utils.FromJSON(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Newest first, same as the redis stream
+	slices.Reverse(entries)
+	return entries[:min(len(entries), limitOf(filter))], nil
+}
+
+func (a *fileAudit) Close() {
+	if err := a.file.Close(); err != nil {
+		log.Error().Caller().Err(err).Send()
+	}
+}
+
+// Record writes an entry without failing the operation it describes
+func Record(ctx context.Context, entry types.AuditEntry) {
+	if Audit == nil {
+		return
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	if err := Audit.Write(ctx, entry); err != nil {
+		log.Error().Caller().Err(err).Str("action", entry.Action).Str("shorty", entry.Shorty).Msg("failed to write audit entry")
+	}
+}
@@ -0,0 +1,399 @@
+package pkg
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"shorty/config"
+	"shorty/types"
+
+	"github.com/rs/zerolog/log"
+)
+
+// hostsNames are the entries every hosts file carries for the machine itself
+var hostsNames = []string{"localhost", "localhost.localdomain", "local", "broadcasthost", "ip6-localhost", "ip6-loopback", "0.0.0.0"}
+
+// blockSet is one loaded generation of the blocklist, swapped in whole on reload
+type blockSet struct {
+	domains  map[string]struct{} // subdomains are blocked with their parent
+	prefixes []string            // url entries, matched as prefix of the destination
+	patterns []*regexp.Regexp    // /regex/ entries, matched against the whole destination
+	loadedAt time.Time
+}
+
+// blocklist keeps malicious destinations from being linked or followed. Entries come from the
+// configured files, in hosts format, one domain or url per line, or /regex/ per line, and from
+// the local file managed through the API.
+type blocklist struct {
+	set      atomic.Pointer[blockSet]
+	mu       sync.Mutex // serializes reloads and edits of the local file
+	local    []string
+	modTimes map[string]time.Time
+}
+
+var Blocklist *blocklist
+
+var (
+	ErrInvalidEntry = errors.New("invalid blocklist entry")
+	ErrNotListed    = errors.New("not on the local blocklist")
+)
+
+func NewBlocklist() (*blocklist, error) {
+	b := &blocklist{}
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Blocked reports the entry target matches, if any
+func Blocked(target string) (string, bool) {
+	if Blocklist == nil {
+		return "", false
+	}
+
+	return Blocklist.Match(target)
+}
+
+// CheckBlocklist rejects destinations on the blocklist
+func CheckBlocklist(target string) error {
+	if entry, ok := Blocked(target); ok {
+		return &URLError{Reason: ReasonBlocklisted, Url: target, Err: fmt.Errorf("matches %s", entry)}
+	}
+
+	return nil
+}
+
+func (b *blocklist) Match(target string) (string, bool) {
+	set := b.set.Load()
+	if set == nil {
+		return "", false
+	}
+
+	lower := strings.ToLower(target)
+	if u, err := url.Parse(lower); err == nil {
+		host := strings.TrimSuffix(u.Hostname(), ".")
+		for host != "" {
+			if _, ok := set.domains[host]; ok {
+				return host, true
+			}
+
+			_, host, _ = strings.Cut(host, ".")
+		}
+	}
+
+	if normalized, ok := normalizeURL(target); ok {
+		for _, prefix := range set.prefixes {
+			if strings.HasPrefix(normalized, prefix) {
+				return prefix, true
+			}
+		}
+	}
+
+	for _, pattern := range set.patterns {
+		if pattern.MatchString(target) {
+			return "/" + strings.TrimPrefix(pattern.String(), "(?i)") + "/", true
+		}
+	}
+
+	return "", false
+}
+
+// Reload reads every file again, the previous generation stays in use if the local file can't be read
+func (b *blocklist) Reload() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.reload()
+}
+
+func (b *blocklist) reload() error {
+	set := &blockSet{domains: make(map[string]struct{}), loadedAt: time.Now()}
+	modTimes := make(map[string]time.Time)
+
+	for _, path := range config.Use.Blocklist.Files {
+		lines, modTime, err := readLines(path)
+		if err != nil {
+			// One broken feed shouldn't unblock everything else
+			log.Error().Err(err).Str("file", path).Msg("failed to read blocklist")
+			continue
+		}
+
+		modTimes[path] = modTime
+		for _, line := range lines {
+			if err := set.add(line); err != nil {
+				log.Warn().Err(err).Str("file", path).Msg("skipping blocklist entry")
+			}
+		}
+	}
+
+	local, modTime, err := readLines(config.Use.Blocklist.Local)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	modTimes[config.Use.Blocklist.Local] = modTime
+	for _, line := range local {
+		if err := set.add(line); err != nil {
+			log.Warn().Err(err).Str("file", config.Use.Blocklist.Local).Msg("skipping blocklist entry")
+		}
+	}
+
+	b.local = local
+	b.modTimes = modTimes
+	b.set.Store(set)
+
+	log.Debug().Int("domains", len(set.domains)).Int("urls", len(set.prefixes)).Int("patterns", len(set.patterns)).Msg("loaded blocklist")
+	return nil
+}
+
+// Add puts an entry on the local file and reloads
+func (b *blocklist) Add(entry string) (string, error) {
+	entry = strings.TrimSpace(entry)
+	if entry == "" || entry[0] == '#' || entry[0] == '!' {
+		return "", fmt.Errorf("%w, it cannot be empty or a comment", ErrInvalidEntry)
+	}
+
+	if err := (&blockSet{domains: make(map[string]struct{})}).add(entry); err != nil {
+		return "", fmt.Errorf("%w %q: %v", ErrInvalidEntry, entry, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if slices.Contains(b.local, entry) {
+		return entry, nil
+	}
+
+	if err := writeLines(config.Use.Blocklist.Local, append(slices.Clone(b.local), entry)); err != nil {
+		return "", err
+	}
+
+	return entry, b.reload()
+}
+
+// Remove takes an entry off the local file, entries of the other files can't be removed here
+func (b *blocklist) Remove(entry string) error {
+	entry = strings.TrimSpace(entry)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !slices.Contains(b.local, entry) {
+		return fmt.Errorf("%s is %w", entry, ErrNotListed)
+	}
+
+	if err := writeLines(config.Use.Blocklist.Local, slices.DeleteFunc(slices.Clone(b.local), func(line string) bool {
+		return line == entry
+	})); err != nil {
+		return err
+	}
+
+	return b.reload()
+}
+
+func (b *blocklist) Info() types.BlocklistInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	info := types.BlocklistInfo{Files: config.Use.Blocklist.Files, Entries: slices.DeleteFunc(slices.Clone(b.local), func(line string) bool {
+		return line == "" || strings.HasPrefix(line, "#")
+	})}
+
+	if set := b.set.Load(); set != nil {
+		info.Domains, info.Urls, info.Patterns, info.LoadedAt = len(set.domains), len(set.prefixes), len(set.patterns), set.loadedAt
+	}
+
+	return info
+}
+
+// StartReloader reloads the blocklist whenever one of its files changed on disk
+func (b *blocklist) StartReloader() {
+	ticker := time.NewTicker(config.Use.Blocklist.Interval)
+	go func() {
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if !b.changed() {
+				continue
+			}
+
+			if err := b.Reload(); err != nil {
+				log.Error().Err(err).Msg("failed to reload blocklist")
+			}
+		}
+	}()
+}
+
+func (b *blocklist) changed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, path := range append(slices.Clone(config.Use.Blocklist.Files), config.Use.Blocklist.Local) {
+		var modTime time.Time
+		if stat, err := os.Stat(path); err == nil {
+			modTime = stat.ModTime()
+		}
+
+		if !modTime.Equal(b.modTimes[path]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// add parses one line of any of the supported formats
+func (s *blockSet) add(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' || line[0] == '!' {
+		return nil
+	}
+
+	// Inline comments, unless the whole line is a /regex/ that may hold " #" itself
+	if !isPattern(line) {
+		if comment := commentIndex(line); comment > 0 {
+			line = strings.TrimSpace(line[:comment])
+		}
+	}
+
+	if isPattern(line) {
+		pattern, err := regexp.Compile("(?i)" + line[1:len(line)-1])
+		if err != nil {
+			return err
+		}
+
+		s.patterns = append(s.patterns, pattern)
+		return nil
+	}
+
+	// Urls block everything below them
+	if strings.Contains(line, "://") {
+		normalized, ok := normalizeURL(line)
+		if !ok {
+			return fmt.Errorf("invalid url %q", line)
+		}
+
+		s.prefixes = append(s.prefixes, normalized)
+		return nil
+	}
+
+	// Hosts format, "0.0.0.0 evil.example another.example"
+	fields := strings.Fields(line)
+	if _, err := netip.ParseAddr(fields[0]); err == nil && len(fields) > 1 {
+		fields = fields[1:]
+	}
+
+	for _, domain := range fields {
+		domain = strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(domain), "*."), ".")
+		if slices.Contains(hostsNames, domain) {
+			continue
+		}
+
+		if domain == "" || strings.ContainsAny(domain, "/:@?#") {
+			return fmt.Errorf("invalid domain %q", domain)
+		}
+
+		s.domains[domain] = struct{}{}
+	}
+
+	return nil
+}
+
+// normalizeURL reduces a url to what url entries are compared by: scheme, host without port,
+// user or root dot and the cleaned path, all lowercased
+func normalizeURL(raw string) (string, bool) {
+	u, err := url.Parse(strings.ToLower(raw))
+	if err != nil || u.Hostname() == "" {
+		return "", false
+	}
+
+	cleaned := "/"
+	if u.Path != "" {
+		// Clean drops a trailing slash, which would let "/dir/" match "/directory"
+		if cleaned = path.Clean("/" + u.Path); cleaned != "/" && strings.HasSuffix(u.Path, "/") {
+			cleaned += "/"
+		}
+	}
+
+	normalized := u.Scheme + "://" + strings.TrimSuffix(u.Hostname(), ".") + cleaned
+	if u.RawQuery != "" {
+		normalized += "?" + u.RawQuery
+	}
+
+	return normalized, true
+}
+
+func isPattern(line string) bool {
+	return len(line) > 2 && line[0] == '/' && line[len(line)-1] == '/'
+}
+
+// commentIndex finds a # that starts a comment after an entry, separated from it by a space or tab
+func commentIndex(line string) int {
+	for i := 1; i < len(line); i++ {
+		if line[i] == '#' && (line[i-1] == ' ' || line[i-1] == '\t') {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func readLines(path string) ([]string, time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines, stat.ModTime(), scanner.Err()
+}
+
+// writeLines replaces path through a rename, so a reload never sees half a file
+func writeLines(path string, lines []string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,583 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"shorty/config"
+	"shorty/types"
+	"shorty/utils"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+	bbolt "go.etcd.io/bbolt"
+)
+
+var linksBucket = []byte("links")
+
+// bolt is an embedded LinkStore for small deployments that don't run a Redis server
+type bolt struct {
+	db *bbolt.DB
+}
+
+type boltEntry struct {
+	Link       types.Link          `json:"link"`
+	Value      string              `json:"value,omitempty"` // bare URL written before records existed
+	S3Key      types.S3Credentials `json:"s3_credentials,omitzero"`
+	ExpiresAt  time.Time           `json:"expires_at,omitzero"`
+	ClicksLeft int64               `json:"clicks_left,omitempty"`
+	History    []types.Revision    `json:"history,omitempty"`
+	Health     *types.Health       `json:"health,omitempty"`
+}
+
+// decodeEntry reads an entry, upgrading legacy ones on the fly
+func decodeEntry(data []byte) (entry boltEntry, legacy bool, err error) {
+	if err = utils.FromJSON(data, &entry); err != nil {
+		return
+	}
+
+	if entry.Value != "" && entry.Link.Url == "" {
+		entry.Link = NewLink(entry.Value)
+		entry.Value = ""
+		legacy = true
+	}
+
+	return
+}
+
+func (e boltEntry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+func NewBolt(path string) (*bolt, error) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		log.Error().Caller().Err(err).Send()
+		return nil, err
+	}
+
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(linksBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &bolt{db: db}, nil
+}
+
+func (b *bolt) Close() {
+	if err := b.db.Close(); err != nil {
+		log.Error().Caller().Err(err).Send()
+	}
+}
+
+// getEntry reads a live entry, expired entries are reported as not found
+func getEntry(bucket *bbolt.Bucket, key string) (boltEntry, error) {
+	data := bucket.Get([]byte(key))
+	if data == nil {
+		return boltEntry{}, fmt.Errorf("not found %s", key)
+	}
+
+	entry, _, err := decodeEntry(data)
+	if err != nil {
+		return entry, err
+	}
+
+	if entry.expired(time.Now()) {
+		return entry, fmt.Errorf("not found %s", key)
+	}
+
+	return entry, nil
+}
+
+func newEntry(link types.Link, s3Creds types.S3Credentials, ttl time.Duration) boltEntry {
+	ttl = expiry(ttl)
+	link.TTL = ttl
+	link.Version = types.LinkVersion
+	entry := boltEntry{
+		Link:       link,
+		S3Key:      s3Creds,
+		ClicksLeft: link.MaxClicks,
+	}
+
+	if ttl > 0 {
+		entry.ExpiresAt = time.Now().Add(ttl)
+	}
+
+	return entry
+}
+
+func (b *bolt) put(key string, link types.Link, s3Creds types.S3Credentials, ttl time.Duration, checkFirst ...bool) error {
+	entry := newEntry(link, s3Creds, ttl)
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(linksBucket)
+		if len(checkFirst) > 0 && checkFirst[0] {
+			if _, err := getEntry(bucket, key); err == nil {
+				return fmt.Errorf("%s %w", key, ErrAlreadyExists)
+			}
+		}
+
+		return bucket.Put([]byte(key), utils.ToJSON(entry))
+	})
+}
+
+func (b *bolt) Set(ctx context.Context, key string, link types.Link, ttl time.Duration, checkFirst ...bool) error {
+	return b.put(key, link, types.S3Credentials{}, ttl, checkFirst...)
+}
+
+func (b *bolt) SetWithS3Credentials(ctx context.Context, key string, link types.Link, s3Creds types.S3Credentials, ttl time.Duration, checkFirst ...bool) error {
+	return b.put(key, link, s3Creds, ttl, checkFirst...)
+}
+
+func (b *bolt) GetS3Credentials(ctx context.Context, key string) (creds types.S3Credentials, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		entry, err := getEntry(tx.Bucket(linksBucket), key)
+		if err != nil {
+			return err
+		}
+
+		if entry.S3Key.Access == "" {
+			return fmt.Errorf("no s3 credentials for %s", key)
+		}
+
+		creds = entry.S3Key
+		return nil
+	})
+
+	return
+}
+
+func (b *bolt) DelS3Credentials(ctx context.Context, key string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(linksBucket)
+
+		entry, err := getEntry(bucket, key)
+		if err != nil || entry.S3Key.Access == "" {
+			return err
+		}
+
+		entry.S3Key = types.S3Credentials{}
+		return bucket.Put([]byte(key), utils.ToJSON(entry))
+	})
+}
+
+func (b *bolt) Get(ctx context.Context, key string) (link types.Link, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		entry, err := getEntry(tx.Bucket(linksBucket), key)
+		link = entry.Link
+		link.ExpiresAt = entry.ExpiresAt
+		return err
+	})
+
+	return
+}
+
+func (b *bolt) List(ctx context.Context) (datas []types.Shorten, err error) {
+	err = b.Each(ctx, func(shorten types.Shorten) bool {
+		datas = append(datas, shorten)
+		return true
+	})
+
+	return
+}
+
+// errStopEach ends a ForEach early, it never leaves Each
+var errStopEach = errors.New("stop")
+
+func (b *bolt) Each(ctx context.Context, fn func(types.Shorten) bool) error {
+	now := time.Now()
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(linksBucket).ForEach(func(k, v []byte) error {
+			entry, _, err := decodeEntry(v)
+			if err != nil || entry.expired(now) {
+				return nil
+			}
+
+			ttl := time.Duration(-1)
+			if !entry.ExpiresAt.IsZero() {
+				ttl = entry.ExpiresAt.Sub(now)
+			}
+
+			// The entry holds the expiry, not the link
+			entry.Link.ExpiresAt = entry.ExpiresAt
+			shorten := entry.Link.Shorten(string(k), ttl)
+			shorten.ClicksLeft = entry.ClicksLeft
+			shorten.Health = entry.Health
+			shorten.HasS3Key = entry.S3Key.Access != ""
+			if !fn(shorten) {
+				return errStopEach
+			}
+
+			return nil
+		})
+	})
+
+	if errors.Is(err, errStopEach) {
+		return nil
+	}
+
+	return err
+}
+
+func (b *bolt) TTL(ctx context.Context, key string) (ttl time.Duration, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		entry, err := getEntry(tx.Bucket(linksBucket), key)
+		if err != nil {
+			return err
+		}
+
+		ttl = -1
+		if !entry.ExpiresAt.IsZero() {
+			ttl = time.Until(entry.ExpiresAt)
+		}
+
+		return nil
+	})
+
+	return
+}
+
+func (b *bolt) Rename(ctx context.Context, oldKey, newKey string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(linksBucket)
+
+		if _, err := getEntry(bucket, oldKey); err != nil {
+			return err
+		}
+
+		// Expired leftovers don't count as taken
+		if _, err := getEntry(bucket, newKey); err == nil {
+			return fmt.Errorf("%s %w", newKey, ErrAlreadyExists)
+		}
+
+		data := bucket.Get([]byte(oldKey))
+
+		if err := bucket.Put([]byte(newKey), data); err != nil {
+			return err
+		}
+
+		return bucket.Delete([]byte(oldKey))
+	})
+}
+
+func (b *bolt) Update(ctx context.Context, key string, link types.Link, ttl time.Duration, rev *types.Revision) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(linksBucket)
+
+		entry, err := getEntry(bucket, key)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case ttl > 0:
+			link.TTL = ttl
+			entry.ExpiresAt = time.Now().Add(ttl)
+		case ttl < 0:
+			link.TTL = 0
+			entry.ExpiresAt = time.Time{}
+		}
+
+		// A new limit starts counting again
+		if link.MaxClicks != entry.Link.MaxClicks {
+			entry.ClicksLeft = link.MaxClicks
+		}
+
+		link.Version = types.LinkVersion
+		entry.Link = link
+
+		if rev != nil {
+			entry.History = append([]types.Revision{*rev}, entry.History...)
+			entry.History = entry.History[:min(int64(len(entry.History)), max(config.Use.History.Max, 1))]
+
+			// The last check was of the previous destination
+			entry.Health = nil
+		}
+
+		return bucket.Put([]byte(key), utils.ToJSON(entry))
+	})
+}
+
+func (b *bolt) History(ctx context.Context, key string) (history []types.Revision, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		entry, err := getEntry(tx.Bucket(linksBucket), key)
+		history = entry.History
+		return err
+	})
+
+	return
+}
+
+func (b *bolt) TagCounts(ctx context.Context) (map[string]int64, error) {
+	counts := make(map[string]int64)
+
+	list, err := b.List(ctx)
+	for _, item := range list {
+		for _, tag := range item.Tags {
+			counts[tag]++
+		}
+	}
+
+	return counts, err
+}
+
+func (b *bolt) Tagged(ctx context.Context, tag string) (shorties []string, err error) {
+	list, err := b.List(ctx)
+	for _, item := range list {
+		if slices.Contains(item.Tags, tag) {
+			shorties = append(shorties, item.Shorty)
+		}
+	}
+
+	slices.Sort(shorties)
+	return
+}
+
+// Migrate rewrites entries still holding a bare URL into versioned records
+func (b *bolt) Migrate(ctx context.Context) (upgraded int, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(linksBucket)
+
+		upgrades := make(map[string][]byte)
+		if err := bucket.ForEach(func(k, v []byte) error {
+			entry, legacy, err := decodeEntry(v)
+			if err != nil || !legacy {
+				return nil
+			}
+
+			if !entry.ExpiresAt.IsZero() {
+				entry.Link.TTL = time.Until(entry.ExpiresAt)
+			}
+
+			upgrades[string(k)] = utils.ToJSON(entry)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for k, v := range upgrades {
+			if err := bucket.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+
+		upgraded = len(upgrades)
+		return nil
+	})
+
+	return
+}
+
+// NextSequence backs the sequential generator
+func (b *bolt) NextSequence(ctx context.Context) (n uint64, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		n, err = tx.Bucket(linksBucket).NextSequence()
+		return err
+	})
+
+	return
+}
+
+func (b *bolt) SetHealth(ctx context.Context, key string, health types.Health) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(linksBucket)
+
+		entry, err := getEntry(bucket, key)
+		if err != nil {
+			return err
+		}
+
+		entry.Health = &health
+		return bucket.Put([]byte(key), utils.ToJSON(entry))
+	})
+}
+
+// Consume counts a redirect, returning the clicks left or -1 for unlimited links.
+// Zero means this was the last allowed click and the link is gone.
+func (b *bolt) Consume(ctx context.Context, key string) (left int64, err error) {
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(linksBucket)
+
+		entry, err := getEntry(bucket, key)
+		if err != nil {
+			return err
+		}
+
+		if entry.Link.MaxClicks < 1 {
+			left = -1
+			return nil
+		}
+
+		entry.ClicksLeft--
+		if left = max(entry.ClicksLeft, 0); left == 0 {
+			return bucket.Delete([]byte(key))
+		}
+
+		return bucket.Put([]byte(key), utils.ToJSON(entry))
+	})
+
+	return
+}
+
+func (b *bolt) Del(ctx context.Context, key string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(linksBucket).Delete([]byte(key))
+	})
+}
+
+// SetMany creates every free key in a single transaction
+func (b *bolt) SetMany(ctx context.Context, entries []Entry) []error {
+	errs := make([]error, len(entries))
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(linksBucket)
+		for i, e := range entries {
+			if _, err := getEntry(bucket, e.Key); err == nil {
+				errs[i] = fmt.Errorf("%s %w", e.Key, ErrAlreadyExists)
+				continue
+			}
+
+			errs[i] = bucket.Put([]byte(e.Key), utils.ToJSON(newEntry(e.Link, types.S3Credentials{}, e.TTL)))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+
+	return errs
+}
+
+func (b *bolt) DelMany(ctx context.Context, keys []string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(linksBucket)
+		for _, key := range keys {
+			if err := bucket.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b *bolt) StartCleanupScheduler() {
+	// Bolt has no expiry of its own, expired entries stay on disk until they are swept
+	if config.Use.Store.SweepInterval > 0 {
+		go every(config.Use.Store.SweepInterval, "expired entries", b.removeExpired)
+	}
+
+	if config.Use.S3.Enable && config.Use.S3.CleanupInterval > 0 {
+		go every(config.Use.S3.CleanupInterval, "expired objects", b.removeOrphans)
+	}
+}
+
+// every runs job at once and then on each tick of interval
+func every(interval time.Duration, name string, job func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(); err != nil {
+			log.Error().Err(err).Msgf("failed to cleanup %s", name)
+		} else {
+			log.Debug().Msgf("completed scheduled cleanup of %s", name)
+		}
+
+		<-ticker.C
+	}
+}
+
+// removeExpired purges expired entries
+func (b *bolt) removeExpired() error {
+	now := time.Now()
+
+	if err := b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(linksBucket)
+
+		var expiredKeys [][]byte
+		if err := bucket.ForEach(func(k, v []byte) error {
+			entry, _, err := decodeEntry(v)
+			if err == nil && entry.expired(now) {
+				expiredKeys = append(expiredKeys, append([]byte(nil), k...))
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, k := range expiredKeys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to purge expired entries: %w", err)
+	}
+
+	return nil
+}
+
+// removeOrphans deletes S3 objects no live entry references
+func (b *bolt) removeOrphans() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	validS3Files := make(map[string]struct{})
+	now := time.Now()
+
+	if err := b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(linksBucket).ForEach(func(k, v []byte) error {
+			entry, _, err := decodeEntry(v)
+			if err != nil {
+				return nil
+			}
+
+			if file := getFile(entry.Link.Url); file != "" && !entry.expired(now) {
+				validS3Files[file] = struct{}{}
+			}
+
+			return nil
+		})
+	}); err != nil {
+		return fmt.Errorf("failed to list live objects: %w", err)
+	}
+
+	if utils.Storage == nil {
+		return errors.New("s3 storage is not initialized")
+	}
+
+	objectCh := utils.Storage.Conn().ListObjects(ctx, config.Use.S3.Bucket, minio.ListObjectsOptions{
+		Recursive: true,
+	})
+
+	for object := range objectCh {
+		if object.Err != nil {
+			log.Error().Err(object.Err).Msg("error listing S3 objects")
+			continue
+		}
+
+		if _, exists := validS3Files[object.Key]; !exists {
+			if err := utils.Storage.Delete(object.Key); err != nil {
+				log.Error().Caller().Err(err).Str("file", object.Key).Msg("failed to delete orphaned S3 object")
+				continue
+			}
+
+			log.Info().Str("file", object.Key).Msg("removed orphaned S3 object")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"shorty/config"
+	"shorty/utils"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sqids/sqids-go"
+)
+
+const (
+	GeneratorPronounceable = "pronounceable"
+	GeneratorBase62        = "base62"
+	GeneratorSequential    = "sequential"
+	GeneratorWords         = "words"
+
+	base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	// maxBlockedRetries bounds how often a blocked candidate is thrown away
+	maxBlockedRetries = 100
+)
+
+// defaultBlocklist is always applied on top of generator.blocklist
+var defaultBlocklist = []string{"anal", "anus", "cock", "cum", "cunt", "dick", "fag", "fuck", "nazi", "nigg", "porn", "rape", "sex", "shit", "slut", "tits", "twat", "whore"}
+
+// Generator produces a candidate shorty of about length characters
+type Generator interface {
+	Generate(ctx context.Context, length int) (string, error)
+}
+
+var (
+	generators = map[string]Generator{
+		GeneratorPronounceable: pronounceable{},
+		GeneratorBase62:        base62{},
+		GeneratorSequential:    &sequential{},
+		GeneratorWords:         words{},
+	}
+
+	// growth is the extra length learned from collisions, per generator
+	growth sync.Map
+)
+
+func IsGenerator(mode string) bool {
+	_, ok := generators[mode]
+	return ok
+}
+
+// GenerateShorty returns a non-blocked candidate from mode (or the configured default).
+// attempt is the number of collisions seen so far for this create, each one adds a character.
+func GenerateShorty(ctx context.Context, mode string, length, attempt int) (string, error) {
+	if mode == "" {
+		mode = config.Use.Generator.Mode
+	}
+
+	gen, ok := generators[mode]
+	if !ok {
+		return "", fmt.Errorf("unknown generator %q", mode)
+	}
+
+	if length < 1 {
+		length = config.Use.Generator.Length
+	}
+
+	length = min(length+int(growthOf(mode).Load())+attempt, config.Use.Generator.MaxLength)
+	for range maxBlockedRetries {
+		shorty, err := gen.Generate(ctx, length)
+		if err != nil {
+			return "", err
+		}
+
+		if !isBlocked(shorty) {
+			return shorty, nil
+		}
+	}
+
+	return "", fmt.Errorf("generator %s keeps producing blocked words", mode)
+}
+
+// Crowded is reported after a create needed retries, so later names start longer
+func Crowded(mode string, attempts int) {
+	if mode == "" {
+		mode = config.Use.Generator.Mode
+	}
+
+	if attempts < 2 {
+		return
+	}
+
+	g := growthOf(mode)
+	if config.Use.Generator.Length+int(g.Load()) < config.Use.Generator.MaxLength {
+		log.Info().Str("generator", mode).Int32("growth", g.Add(1)).Msg("keyspace crowded, growing shorty length")
+	}
+}
+
+func growthOf(mode string) *atomic.Int32 {
+	g, _ := growth.LoadOrStore(mode, &atomic.Int32{})
+	return g.(*atomic.Int32)
+}
+
+func isBlocked(shorty string) bool {
+	lower := strings.ToLower(shorty)
+	for _, list := range [][]string{defaultBlocklist, config.Use.Generator.Blocklist} {
+		for _, word := range list {
+			if word != "" && strings.Contains(lower, strings.ToLower(word)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type pronounceable struct{}
+
+func (pronounceable) Generate(_ context.Context, length int) (string, error) {
+	return utils.HumanFriendlyEnglishString(length), nil
+}
+
+type base62 struct{}
+
+func (base62) Generate(_ context.Context, length int) (string, error) {
+	return randomString(base62Alphabet, length)
+}
+
+// sequential encodes a store-wide counter with sqids, so codes are short but not guessable in order
+type sequential struct {
+	mu       sync.Mutex
+	byLength map[int]*sqids.Sqids
+}
+
+// encoder returns the sqids instance padding to length, MinLength is fixed per instance
+func (s *sequential) encoder(length int) (*sqids.Sqids, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if enc, ok := s.byLength[length]; ok {
+		return enc, nil
+	}
+
+	opts := sqids.Options{
+		MinLength: uint8(min(length, 255)),
+		Blocklist: append(sqids.Blocklist(), config.Use.Generator.Blocklist...),
+	}
+	if config.Use.Generator.Alphabet != "" {
+		opts.Alphabet = config.Use.Generator.Alphabet
+	}
+
+	enc, err := sqids.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.byLength == nil {
+		s.byLength = make(map[int]*sqids.Sqids)
+	}
+	s.byLength[length] = enc
+
+	return enc, nil
+}
+
+func (s *sequential) Generate(ctx context.Context, length int) (string, error) {
+	enc, err := s.encoder(length)
+	if err != nil {
+		return "", err
+	}
+
+	n, err := Store.NextSequence(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return enc.Encode([]uint64{n})
+}
+
+// words builds names like brave-otter-42, length controls the digits of the suffix
+type words struct{}
+
+func (words) Generate(_ context.Context, length int) (string, error) {
+	adjective, err := randomItem(adjectives)
+	if err != nil {
+		return "", err
+	}
+
+	animal, err := randomItem(animals)
+	if err != nil {
+		return "", err
+	}
+
+	digits := max(length-6, 2)
+	number, err := randomString("0123456789", digits)
+	if err != nil {
+		return "", err
+	}
+
+	return adjective + "-" + animal + "-" + number, nil
+}
+
+func randomString(alphabet string, length int) (string, error) {
+	b := make([]byte, length)
+	limit := big.NewInt(int64(len(alphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[n.Int64()]
+	}
+
+	return string(b), nil
+}
+
+func randomItem(list []string) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(list))))
+	if err != nil {
+		return "", err
+	}
+
+	return list[n.Int64()], nil
+}
+
+var adjectives = []string{
+	"able", "agile", "amber", "ample", "azure", "bold", "brave", "bright", "brisk", "calm",
+	"clever", "cosmic", "crisp", "curious", "daring", "dusty", "eager", "early", "fancy", "fast",
+	"fierce", "fluffy", "gentle", "giant", "glad", "golden", "grand", "happy", "hardy", "honest",
+	"humble", "jolly", "keen", "kind", "lively", "lucky", "mellow", "merry", "mighty", "misty",
+	"neat", "nimble", "noble", "plucky", "polite", "proud", "quick", "quiet", "rapid", "rosy",
+	"rustic", "shiny", "silent", "smart", "snowy", "solid", "sunny", "swift", "tidy", "witty",
+}
+
+var animals = []string{
+	"badger", "bear", "beaver", "bison", "camel", "cobra", "crane", "crow", "deer", "dingo",
+	"dolphin", "eagle", "falcon", "ferret", "finch", "fox", "gecko", "gibbon", "goose", "heron",
+	"hippo", "ibis", "jackal", "koala", "lemur", "lion", "llama", "lynx", "marten", "mole",
+	"moose", "newt", "okapi", "orca", "otter", "owl", "panda", "parrot", "pelican", "puffin",
+	"quail", "rabbit", "raven", "robin", "salmon", "seal", "shark", "sloth", "stork", "swan",
+	"tapir", "tiger", "toucan", "trout", "turtle", "walrus", "weasel", "whale", "wolf", "yak",
+}
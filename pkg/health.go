@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"shorty/config"
+	"shorty/types"
+
+	"github.com/rs/zerolog/log"
+)
+
+// StartHealthChecker probes the destination of every url link each health.interval,
+// uploads are ours and not checked
+func StartHealthChecker() {
+	ticker := time.NewTicker(config.Use.Health.Interval)
+	go func() {
+		defer ticker.Stop()
+		if err := checkLinks(); err != nil {
+			log.Error().Err(err).Msg("failed to check link health")
+		}
+
+		for range ticker.C {
+			if err := checkLinks(); err != nil {
+				log.Error().Err(err).Msg("failed to check link health")
+			}
+		}
+	}()
+}
+
+func checkLinks() error {
+	// A round never runs into the next one
+	ctx, cancel := context.WithTimeout(context.Background(), config.Use.Health.Interval)
+	defer cancel()
+
+	list, err := Store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	var checked, broken atomic.Int64
+	sem := make(chan struct{}, max(config.Use.Health.Workers, 1))
+
+	for _, item := range list {
+		if item.Kind == types.KindFile {
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			health := CheckHealth(ctx, item.Url)
+			if err := Store.SetHealth(ctx, item.Shorty, health); err != nil {
+				// Expired or deleted since the list was taken
+				log.Debug().Err(err).Str("shorty", item.Shorty).Msg("failed to store link health")
+				return
+			}
+
+			checked.Add(1)
+			if health.State() == types.HealthBroken {
+				broken.Add(1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	log.Debug().Int64("links", checked.Load()).Int64("broken", broken.Load()).Msg("completed health check of links")
+	return nil
+}
+
+// CheckHealth probes target and records the outcome instead of rejecting it
+func CheckHealth(ctx context.Context, target string) types.Health {
+	ctx, cancel := context.WithTimeout(ctx, config.Use.Health.Timeout)
+	defer cancel()
+
+	return checkHealth(ctx, target)
+}
+
+// checkHealth is CheckHealth within the deadline of ctx
+func checkHealth(ctx context.Context, target string) types.Health {
+	start := time.Now()
+	res, err := probe(ctx, target)
+	health := types.Health{LatencyMs: time.Since(start).Milliseconds(), CheckedAt: time.Now().UTC()}
+	if err != nil {
+		health.Error = urlError(target, err).Error()
+		return health
+	}
+
+	health.Status = res.StatusCode
+	return health
+}
@@ -0,0 +1,24 @@
+package pkg
+
+import (
+	"context"
+	"time"
+)
+
+// Attempt counts an attempt under key before it is checked, so concurrent attempts can't all
+// pass the limit, the window starts with the first attempt
+func (r *redis) Attempt(ctx context.Context, key string, window time.Duration) (int64, error) {
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	return incr.Val(), nil
+}
+
+// ResetAttempts forgets the attempts counted under key
+func (r *redis) ResetAttempts(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key).Err()
+}
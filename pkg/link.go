@@ -0,0 +1,60 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"shorty/config"
+	"shorty/types"
+	"shorty/utils"
+)
+
+// NewLink builds a fresh record for url, detecting whether it points into our own bucket
+func NewLink(url string) types.Link {
+	now := time.Now().UTC()
+	link := types.Link{
+		Version:   types.LinkVersion,
+		Url:       url,
+		Kind:      types.KindURL,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if object := objectKey(url); object != "" {
+		link.Kind = types.KindFile
+		link.Object = object
+	}
+
+	return link
+}
+
+// objectKey returns the object name when url is served from the configured S3 bucket
+func objectKey(url string) string {
+	if !config.Use.S3.Enable {
+		return ""
+	}
+
+	prefix := fmt.Sprintf("https://%s/%s/", config.Use.S3.Endpoint, config.Use.S3.Bucket)
+	if !strings.HasPrefix(url, prefix) {
+		return ""
+	}
+
+	return strings.SplitN(strings.TrimPrefix(url, prefix), "?", 2)[0]
+}
+
+func encodeLink(link types.Link) []byte {
+	link.Version = types.LinkVersion
+	return utils.ToJSON(link)
+}
+
+// decodeLink reads a record, bare URL strings written before records existed are upgraded on the fly
+func decodeLink(data []byte) (link types.Link, legacy bool, err error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return NewLink(string(data)), true, nil
+	}
+
+	err = utils.FromJSON(data, &link)
+	return link, false, err
+}
@@ -7,6 +7,8 @@ import (
 	"net"
 	"net/url"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,11 +25,16 @@ type redis struct {
 	client *goredis.Client
 }
 
-var Redis, RedisAuth *redis
+var RedisAuth *redis
 
 const (
 	s3CachePrefix = "s3_exists:"
 	s3CredPrefix  = "s3_cred:"
+	clicksPrefix  = "clicks_left:"
+	historyPrefix = "history:"
+	tagPrefix     = "tag:"
+	healthPrefix  = "health:"
+	sequenceKey   = "shorty_sequence"
 )
 
 func NewRedis(useDB ...int) (*redis, error) {
@@ -60,40 +67,72 @@ func (r *redis) Close() {
 	}
 }
 
-func (r *redis) Set(ctx context.Context, key string, value any, ttl time.Duration, checkFirst ...bool) error {
-	if ttl < 1 {
-		ttl = 30 * time.Minute
+// setScript writes a link together with its click counter so a limited link never exists without one.
+// KEYS are the link and its counter, ARGV the record, ttl in ms (0 never expires), "1" to create only
+// if the key is free and max clicks.
+var setScript = goredis.NewScript(`
+local args = {"SET", KEYS[1], ARGV[1]}
+if tonumber(ARGV[2]) > 0 then
+	table.insert(args, "PX")
+	table.insert(args, ARGV[2])
+end
+if ARGV[3] == "1" then
+	table.insert(args, "NX")
+end
+if not redis.call(unpack(args)) then
+	return 0
+end
+redis.call("DEL", KEYS[2])
+if tonumber(ARGV[4]) > 0 then
+	redis.call("SET", KEYS[2], ARGV[4])
+	if tonumber(ARGV[2]) > 0 then
+		redis.call("PEXPIRE", KEYS[2], ARGV[2])
+	end
+end
+return 1
+`)
+
+// setArgs are the ARGV of setScript for link
+func setArgs(link types.Link, ttl time.Duration, nx bool) []any {
+	flag := "0"
+	if nx {
+		flag = "1"
 	}
 
-	valueStr := fmt.Sprint(value)
+	return []any{encodeLink(link), ttl.Milliseconds(), flag, link.MaxClicks}
+}
 
-	if len(checkFirst) > 0 && checkFirst[0] {
-		exists, err := r.client.Exists(ctx, valueStr).Result()
-		if err != nil {
-			return err
-		}
+func (r *redis) Set(ctx context.Context, key string, link types.Link, ttl time.Duration, checkFirst ...bool) error {
+	ttl = expiry(ttl)
+	link.TTL = ttl
+	link.ExpiresAt = expiresAt(ttl)
 
-		if exists > 0 {
-			return fmt.Errorf("%s already exists", value)
-		}
+	// checkFirst creates the key only if it is free, in a single SET NX so concurrent creates can't both win
+	nx := len(checkFirst) > 0 && checkFirst[0]
+	created, err := setScript.Run(ctx, r.client, []string{key, clicksPrefix + key}, setArgs(link, ttl, nx)...).Int()
+	if err != nil {
+		return err
 	}
 
-	if err := r.client.Set(ctx, key, value, ttl).Err(); err != nil {
-		return err
+	if created == 0 {
+		return fmt.Errorf("%s %w", key, ErrAlreadyExists)
 	}
 
-	if file := checkIsS3File(valueStr); file != "" {
+	r.tag(ctx, key, link.Tags, nil)
+
+	// Cleanup scheduler relies on this to find objects of expired links
+	if link.Kind == types.KindFile && link.Object != "" {
 		s3CacheKey := s3CachePrefix + key
-		r.client.Set(ctx, s3CacheKey, file, ttl)
+		r.client.Set(ctx, s3CacheKey, link.Object, ttl)
 	}
 
 	return nil
 }
 
 // SetWithS3Credentials sets a URL with associated S3 credentials
-func (r *redis) SetWithS3Credentials(ctx context.Context, key string, value any, s3Creds types.S3Credentials, ttl time.Duration, checkFirst ...bool) error {
+func (r *redis) SetWithS3Credentials(ctx context.Context, key string, link types.Link, s3Creds types.S3Credentials, ttl time.Duration, checkFirst ...bool) error {
 	// First set the main URL
-	if err := r.Set(ctx, key, value, ttl, checkFirst...); err != nil {
+	if err := r.Set(ctx, key, link, ttl, checkFirst...); err != nil {
 		return err
 	}
 
@@ -125,43 +164,155 @@ func (r *redis) GetS3Credentials(ctx context.Context, key string) (types.S3Crede
 	return creds, nil
 }
 
-func (r *redis) Get(ctx context.Context, key string) (string, error) {
+// DelS3Credentials drops the S3 credentials of a key, the link itself stays
+func (r *redis) DelS3Credentials(ctx context.Context, key string) error {
+	return r.client.Del(ctx, s3CredPrefix+key).Err()
+}
+
+func (r *redis) Get(ctx context.Context, key string) (types.Link, error) {
 	data, err := r.client.Get(ctx, key).Bytes()
 	if err == goredis.Nil {
-		err = fmt.Errorf("not found %s", key)
+		return types.Link{}, fmt.Errorf("not found %s", key)
+	}
+
+	if err != nil {
+		return types.Link{}, err
 	}
 
-	return string(data), err
+	link, _, err := decodeLink(data)
+	return link, err
 }
 
-func (r *redis) GetAll(ctx context.Context) (datas []types.Shorten, err error) {
+func (r *redis) List(ctx context.Context) (datas []types.Shorten, err error) {
+	err = r.Each(ctx, func(shorten types.Shorten) bool {
+		datas = append(datas, shorten)
+		return true
+	})
+
+	return
+}
+
+// eachBatch is how many keys Each asks SCAN for and reads in one pipeline
+const eachBatch = 100
+
+func (r *redis) Each(ctx context.Context, fn func(types.Shorten) bool) error {
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, "*", eachBatch).Result()
+		if err != nil {
+			return err
+		}
+
+		if !r.each(ctx, slices.DeleteFunc(keys, isSidecarKey), fn) || next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// each reads a batch of links with their sidecar keys in one round trip, false stops the walk
+func (r *redis) each(ctx context.Context, keys []string, fn func(types.Shorten) bool) bool {
+	pipe := r.client.Pipeline()
+	values := make([]*goredis.StringCmd, len(keys))
+	ttls := make([]*goredis.DurationCmd, len(keys))
+	clicks := make([]*goredis.StringCmd, len(keys))
+	healths := make([]*goredis.StringCmd, len(keys))
+	creds := make([]*goredis.IntCmd, len(keys))
+	for i, key := range keys {
+		values[i] = pipe.Get(ctx, key)
+		ttls[i] = pipe.TTL(ctx, key)
+		clicks[i] = pipe.Get(ctx, clicksPrefix+key)
+		healths[i] = pipe.Get(ctx, healthPrefix+key)
+		creds[i] = pipe.Exists(ctx, s3CredPrefix+key)
+	}
+
+	// Missing sidecar keys fail their own command only
+	_, _ = pipe.Exec(ctx)
+
+	for i, key := range keys {
+		data, err := values[i].Bytes()
+		if err != nil {
+			continue
+		}
+
+		link, _, err := decodeLink(data)
+		if err != nil {
+			continue
+		}
+
+		shorten := link.Shorten(key, ttls[i].Val())
+		if link.MaxClicks > 0 {
+			shorten.ClicksLeft, _ = clicks[i].Int64()
+		}
+
+		if data, err := healths[i].Bytes(); err == nil {
+			var health types.Health
+			if utils.FromJSON(data, &health) == nil {
+				shorten.Health = &health
+			}
+		}
+		shorten.HasS3Key = creds[i].Val() == 1
+
+		if !fn(shorten) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// migrateScript replaces a value only if nobody changed it since it was read, keeping its TTL
+var migrateScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("SET", KEYS[1], ARGV[2], "KEEPTTL")
+end
+return false
+`)
+
+// Migrate upgrades bare URL values written by older versions into versioned records and fills tag sets
+func (r *redis) Migrate(ctx context.Context) (upgraded int, err error) {
 	iter := r.client.Scan(ctx, 0, "*", 0).Iterator()
 	for iter.Next(ctx) {
 		key := iter.Val()
-		if strings.HasPrefix(key, s3CachePrefix) || strings.HasPrefix(key, s3CredPrefix) {
+		if isSidecarKey(key) {
 			continue
 		}
 
-		url := r.client.Get(ctx, key).Val()
-		s3CacheKey := s3CachePrefix + key
+		data, err := r.client.Get(ctx, key).Bytes()
+		if err != nil {
+			continue
+		}
+
+		link, legacy, err := decodeLink(data)
+		if err != nil {
+			continue
+		}
+
+		// Links tagged before tag sets existed
+		r.tag(ctx, key, link.Tags, nil)
+
+		if !legacy {
+			continue
+		}
+
+		ttl := r.client.TTL(ctx, key).Val()
+		if ttl > 0 {
+			link.TTL = ttl
+			link.ExpiresAt = expiresAt(ttl)
+		}
 
-		file, err := r.client.Get(ctx, s3CacheKey).Result()
-		if err == goredis.Nil {
-			file = checkIsS3File(url)
-			ttl := 20 * time.Minute
-			if file != "" {
-				ttl = r.client.TTL(ctx, key).Val()
+		if err := migrateScript.Run(ctx, r.client, []string{key}, data, encodeLink(link)).Err(); err != nil {
+			if err != goredis.Nil {
+				log.Error().Caller().Err(err).Str("key", key).Msg("failed to migrate link")
 			}
-			r.client.Set(ctx, s3CacheKey, file, ttl)
+			continue
+		}
+
+		if link.Kind == types.KindFile && ttl > 0 {
+			r.client.Set(ctx, s3CachePrefix+key, link.Object, ttl)
 		}
 
-		expired := r.client.TTL(ctx, iter.Val())
-		datas = append(datas, types.Shorten{
-			Url:     url,
-			File:    file,
-			Shorty:  iter.Val(),
-			Expired: expired.Val(),
-		})
+		upgraded++
 	}
 
 	err = iter.Err()
@@ -169,18 +320,300 @@ func (r *redis) GetAll(ctx context.Context) (datas []types.Shorten, err error) {
 	return
 }
 
-func checkIsS3File(input string) string {
-	gf := getFile(input)
-	if gf == "" {
-		return ""
+func (r *redis) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.client.TTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
 	}
 
-	byteFile, err := utils.Storage.Get(gf)
-	if err == nil || byteFile != nil {
-		return ""
+	// -2 means the key does not exist, -1 means it never expires
+	if ttl == -2 {
+		return 0, fmt.Errorf("not found %s", key)
+	}
+
+	return ttl, nil
+}
+
+// renameScript moves a link and its sidecar keys in one step, RENAME keeps every TTL.
+// KEYS are old, new followed by old/new pairs of sidecar keys.
+var renameScript = goredis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+if redis.call("EXISTS", KEYS[2]) == 1 then
+	return -2
+end
+redis.call("RENAME", KEYS[1], KEYS[2])
+for i = 3, #KEYS, 2 do
+	redis.call("DEL", KEYS[i + 1])
+	if redis.call("EXISTS", KEYS[i]) == 1 then
+		redis.call("RENAME", KEYS[i], KEYS[i + 1])
+	end
+end
+return 1
+`)
+
+func (r *redis) Rename(ctx context.Context, oldKey, newKey string) error {
+	keys := []string{oldKey, newKey}
+	for _, prefix := range []string{s3CachePrefix, s3CredPrefix, clicksPrefix, historyPrefix, healthPrefix} {
+		keys = append(keys, prefix+oldKey, prefix+newKey)
+	}
+
+	res, err := renameScript.Run(ctx, r.client, keys).Int()
+	if err != nil {
+		return err
+	}
+
+	switch res {
+	case -1:
+		return fmt.Errorf("not found %s", oldKey)
+	case -2:
+		return fmt.Errorf("%s %w", newKey, ErrAlreadyExists)
+	}
+
+	if link, err := r.Get(ctx, newKey); err == nil {
+		r.tag(ctx, oldKey, nil, link.Tags)
+		r.tag(ctx, newKey, link.Tags, nil)
+	}
+
+	return nil
+}
+
+// consumeScript takes one click off a limited link and deletes it with its sidecar keys after the last one.
+// A link that has max_clicks but lost its counter is treated as used up rather than unlimited.
+// KEYS are the link, its counter and the remaining sidecar keys.
+var consumeScript = goredis.NewScript(`
+local data = redis.call("GET", KEYS[1])
+if not data then
+	return -2
+end
+local ok, link = pcall(cjson.decode, data)
+if not ok or type(link) ~= "table" then
+	link = {}
+end
+local function remove()
+	if type(link.tags) == "table" then
+		for _, tag in ipairs(link.tags) do
+			redis.call("SREM", ARGV[1] .. tag, KEYS[1])
+		end
+	end
+	redis.call("DEL", unpack(KEYS))
+end
+if redis.call("EXISTS", KEYS[2]) == 0 then
+	if tonumber(link.max_clicks or 0) > 0 then
+		remove()
+		return -3
+	end
+	return -1
+end
+local left = redis.call("DECR", KEYS[2])
+if left <= 0 then
+	remove()
+	return 0
+end
+return left
+`)
+
+// Consume counts a redirect, returning the clicks left or -1 for unlimited links.
+// Zero means this was the last allowed click and the link is gone, tag sets included.
+func (r *redis) Consume(ctx context.Context, key string) (int64, error) {
+	keys := []string{key, clicksPrefix + key, s3CachePrefix + key, s3CredPrefix + key, historyPrefix + key, healthPrefix + key}
+
+	left, err := consumeScript.Run(ctx, r.client, keys, tagPrefix).Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	switch left {
+	case -2:
+		return 0, fmt.Errorf("not found %s", key)
+	case -3:
+		return 0, fmt.Errorf("%s %w", key, ErrNoClicksLeft)
+	}
+
+	return left, nil
+}
+
+// updateScript replaces an existing link, pushes the previous destination and keeps sidecar keys
+// expiring together with the link. A ttl of 0 keeps the current one, a negative ttl removes it.
+// A max clicks argument restarts the click counter, empty leaves it as it is.
+// KEYS are the link, its history, s3 cache, s3 credentials, click counter and the remaining sidecar keys.
+var updateScript = goredis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+if ARGV[5] ~= "" then
+	redis.call("DEL", KEYS[5])
+	if tonumber(ARGV[5]) > 0 then
+		redis.call("SET", KEYS[5], ARGV[5])
+	end
+end
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ttl)
+elseif ttl < 0 then
+	redis.call("SET", KEYS[1], ARGV[1])
+else
+	redis.call("SET", KEYS[1], ARGV[1], "KEEPTTL")
+	ttl = redis.call("PTTL", KEYS[1])
+end
+if ARGV[3] ~= "" then
+	redis.call("LPUSH", KEYS[2], ARGV[3])
+	redis.call("LTRIM", KEYS[2], 0, tonumber(ARGV[4]) - 1)
+end
+for i = 2, #KEYS do
+	if ttl > 0 then
+		redis.call("PEXPIRE", KEYS[i], ttl)
+	else
+		redis.call("PERSIST", KEYS[i])
+	end
+end
+return 1
+`)
+
+func (r *redis) Update(ctx context.Context, key string, link types.Link, ttl time.Duration, rev *types.Revision) error {
+	if ttl != 0 {
+		link.TTL = max(ttl, 0)
+		link.ExpiresAt = expiresAt(ttl)
+	}
+
+	var revision []byte
+	if rev != nil {
+		revision = utils.ToJSON(rev)
+	}
+
+	// Needed to move the key between tag sets and to tell whether the click limit changed
+	old, _ := r.Get(ctx, key)
+
+	var clicks string
+	if link.MaxClicks != old.MaxClicks {
+		clicks = strconv.FormatInt(link.MaxClicks, 10)
+	}
+
+	keys := []string{key, historyPrefix + key, s3CachePrefix + key, s3CredPrefix + key, clicksPrefix + key, healthPrefix + key, searchPrefix + key}
+	res, err := updateScript.Run(ctx, r.client, keys, encodeLink(link), ttl.Milliseconds(), revision, config.Use.History.Max, clicks).Int()
+	if err != nil {
+		return err
+	}
+
+	if res == -1 {
+		return fmt.Errorf("not found %s", key)
+	}
+
+	r.tag(ctx, key, link.Tags, old.Tags)
+
+	// The last check was of the previous destination
+	if rev != nil {
+		r.client.Del(ctx, healthPrefix+key)
+	}
+
+	return nil
+}
+
+func (r *redis) History(ctx context.Context, key string) ([]types.Revision, error) {
+	items, err := r.client.LRange(ctx, historyPrefix+key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]types.Revision, 0, len(items))
+	for _, item := range items {
+		var rev types.Revision
+		if err := utils.FromJSON([]byte(item), &rev); err != nil {
+			continue
+		}
+
+		revisions = append(revisions, rev)
 	}
 
-	return gf
+	return revisions, nil
+}
+
+// tag moves key between tag sets, remove is applied first so tags in both are kept
+func (r *redis) tag(ctx context.Context, key string, add, remove []string) {
+	if len(add) == 0 && len(remove) == 0 {
+		return
+	}
+
+	pipe := r.client.Pipeline()
+	for _, tag := range remove {
+		pipe.SRem(ctx, tagPrefix+tag, key)
+	}
+	for _, tag := range add {
+		pipe.SAdd(ctx, tagPrefix+tag, key)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Error().Caller().Err(err).Str("key", key).Msg("failed to update tag sets")
+	}
+}
+
+// members returns the live shorties of a tag set, members whose link expired are dropped
+func (r *redis) members(ctx context.Context, tag string) ([]string, error) {
+	members, err := r.client.SMembers(ctx, tagPrefix+tag).Result()
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+
+	pipe := r.client.Pipeline()
+	exists := make([]*goredis.IntCmd, len(members))
+	for i, member := range members {
+		exists[i] = pipe.Exists(ctx, member)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	live := make([]string, 0, len(members))
+	var stale []any
+	for i, member := range members {
+		if exists[i].Val() == 1 {
+			live = append(live, member)
+		} else {
+			stale = append(stale, member)
+		}
+	}
+
+	if len(stale) > 0 {
+		r.client.SRem(ctx, tagPrefix+tag, stale...)
+	}
+
+	return live, nil
+}
+
+func (r *redis) TagCounts(ctx context.Context) (map[string]int64, error) {
+	counts := make(map[string]int64)
+
+	iter := r.client.Scan(ctx, 0, tagPrefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		tag := strings.TrimPrefix(iter.Val(), tagPrefix)
+		members, err := r.members(ctx, tag)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(members) > 0 {
+			counts[tag] = int64(len(members))
+		}
+	}
+
+	return counts, iter.Err()
+}
+
+func (r *redis) Tagged(ctx context.Context, tag string) ([]string, error) {
+	members, err := r.members(ctx, tag)
+	slices.Sort(members)
+	return members, err
+}
+
+func isSidecarKey(key string) bool {
+	return strings.HasPrefix(key, s3CachePrefix) || strings.HasPrefix(key, s3CredPrefix) || strings.HasPrefix(key, clicksPrefix) || strings.HasPrefix(key, historyPrefix) || strings.HasPrefix(key, searchPrefix) || strings.HasPrefix(key, tagPrefix) || strings.HasPrefix(key, healthPrefix) || key == sequenceKey
+}
+
+// NextSequence backs the sequential generator
+func (r *redis) NextSequence(ctx context.Context) (uint64, error) {
+	n, err := r.client.Incr(ctx, sequenceKey).Result()
+	return uint64(n), err
 }
 
 func getFile(input string) string {
@@ -211,14 +644,128 @@ func getFile(input string) string {
 }
 
 func (r *redis) Del(ctx context.Context, key string) error {
+	if link, err := r.Get(ctx, key); err == nil {
+		r.tag(ctx, key, nil, link.Tags)
+	}
+
 	s3CacheKey := s3CachePrefix + key
 	s3CredKey := s3CredPrefix + key
 	_ = r.client.Del(ctx, s3CacheKey).Err()
 	_ = r.client.Del(ctx, s3CredKey).Err()
+	_ = r.client.Del(ctx, clicksPrefix+key).Err()
+	_ = r.client.Del(ctx, historyPrefix+key).Err()
+	_ = r.client.Del(ctx, healthPrefix+key).Err()
 	return r.client.Del(ctx, key).Err()
 }
 
+// SetHealth stores the result of a health check, expiring together with the link
+func (r *redis) SetHealth(ctx context.Context, key string, health types.Health) error {
+	ttl, err := r.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	// -2 is a missing key, -1 one without expiry
+	if ttl == -2 {
+		return fmt.Errorf("not found %s", key)
+	}
+
+	return r.client.Set(ctx, healthPrefix+key, utils.ToJSON(health), max(ttl, 0)).Err()
+}
+
+// SetMany creates every entry with its click counter in one pipeline, the other sidecar keys follow in
+// a second one for the entries that got created
+func (r *redis) SetMany(ctx context.Context, entries []Entry) []error {
+	errs := make([]error, len(entries))
+	if len(entries) == 0 {
+		return errs
+	}
+
+	// EVALSHA can't fall back to EVAL inside a pipeline, so make sure the script is loaded
+	if err := setScript.Load(ctx, r.client).Err(); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	pipe := r.client.Pipeline()
+	created := make([]*goredis.Cmd, len(entries))
+	for i, entry := range entries {
+		entry.Link.TTL = expiry(entry.TTL)
+		entry.Link.ExpiresAt = expiresAt(entry.Link.TTL)
+		keys := []string{entry.Key, clicksPrefix + entry.Key}
+		created[i] = setScript.EvalSha(ctx, pipe, keys, setArgs(entry.Link, entry.Link.TTL, true)...)
+	}
+
+	// Exec only reports the first failure, every command keeps its own
+	_, _ = pipe.Exec(ctx)
+
+	sidecars := r.client.Pipeline()
+	for i, entry := range entries {
+		ok, err := created[i].Int()
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		if ok == 0 {
+			errs[i] = fmt.Errorf("%s %w", entry.Key, ErrAlreadyExists)
+			continue
+		}
+
+		ttl := expiry(entry.TTL)
+		for _, tag := range entry.Link.Tags {
+			sidecars.SAdd(ctx, tagPrefix+tag, entry.Key)
+		}
+
+		if entry.Link.Kind == types.KindFile && entry.Link.Object != "" {
+			sidecars.Set(ctx, s3CachePrefix+entry.Key, entry.Link.Object, ttl)
+		}
+	}
+
+	if _, err := sidecars.Exec(ctx); err != nil {
+		log.Error().Caller().Err(err).Msg("failed to write sidecar keys of batch")
+	}
+
+	return errs
+}
+
+// DelMany deletes keys and their sidecar keys in one pipeline
+func (r *redis) DelMany(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	// Tags are needed to take the keys out of their tag sets
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := r.client.Pipeline()
+	for i, key := range keys {
+		if data, ok := values[i].(string); ok {
+			if link, _, err := decodeLink([]byte(data)); err == nil {
+				for _, tag := range link.Tags {
+					pipe.SRem(ctx, tagPrefix+tag, key)
+				}
+			}
+		}
+
+		pipe.Del(ctx, key, s3CachePrefix+key, s3CredPrefix+key, clicksPrefix+key, historyPrefix+key, healthPrefix+key)
+	}
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
 func (r *redis) StartCleanupScheduler() {
+	// Redis expires links on its own, only orphaned objects are left to clean up
+	if !config.Use.S3.Enable || config.Use.S3.CleanupInterval <= 0 {
+		return
+	}
+
 	ticker := time.NewTicker(config.Use.S3.CleanupInterval)
 	go func() {
 		defer ticker.Stop()
@@ -248,18 +795,23 @@ func (r *redis) removeExpiredS3Objects() error {
 	for iter.Next(ctx) {
 		key := iter.Val()
 		// Skip special prefix keys in this pass
-		if strings.HasPrefix(key, s3CachePrefix) || strings.HasPrefix(key, s3CredPrefix) {
+		if isSidecarKey(key) {
+			continue
+		}
+
+		// Get link record
+		data, err := r.client.Get(ctx, key).Bytes()
+		if err != nil {
 			continue
 		}
 
-		// Get URL value
-		url, err := r.client.Get(ctx, key).Result()
+		link, _, err := decodeLink(data)
 		if err != nil {
 			continue
 		}
 
 		// Check if URL points to S3
-		if file := getFile(url); file != "" {
+		if file := getFile(link.Url); file != "" {
 			validS3Files[file] = struct{}{}
 		}
 	}
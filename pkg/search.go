@@ -0,0 +1,451 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"shorty/config"
+	"shorty/types"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	searchIndexName = "idx:links"
+	searchPrefix    = "search:"
+	searchMaxResult = 500
+)
+
+// SearchIndex finds shorties by part of their name or destination. Results may include links
+// that expired since they were indexed, callers resolve them against the Store.
+type SearchIndex interface {
+	Index(ctx context.Context, shorty string, link types.Link) error
+	Remove(ctx context.Context, shorty string) error
+	Search(ctx context.Context, query types.SearchQuery) ([]string, error)
+	Close()
+}
+
+var Search SearchIndex
+
+// NewSearchIndex opens the backend selected by search.driver, "auto" prefers RediSearch.
+// RediSearch only indexes DB 0, so links kept anywhere else get the in-process index.
+func NewSearchIndex(ctx context.Context) (SearchIndex, error) {
+	driver := config.Use.Search.Driver
+	if (driver == "" || driver == "auto" || driver == "redisearch") && !linksInDB0() {
+		log.Warn().Str("store", config.Use.Store.Driver).Int("db", config.Use.Redis.DB.Main).
+			Msg("redisearch only indexes redis DB 0, using in-process search index")
+		return newMemorySearch(), nil
+	}
+
+	switch driver {
+	case "", "auto":
+		index, err := newRediSearch(ctx)
+		if err == nil {
+			return index, nil
+		}
+
+		log.Info().Err(err).Msg("redisearch is not available, using in-process search index")
+		return newMemorySearch(), nil
+	case "redisearch":
+		return newRediSearch(ctx)
+	case "memory":
+		return newMemorySearch(), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown search driver %q", config.Use.Search.Driver)
+	}
+}
+
+// linksInDB0 tells whether links live where RediSearch can see them
+func linksInDB0() bool {
+	return (config.Use.Store.Driver == "" || config.Use.Store.Driver == "redis") && config.Use.Redis.DB.Main == 0
+}
+
+// Reindex fills the index with every stored link, links created before the index existed included
+func Reindex(ctx context.Context) (int, error) {
+	if Search == nil {
+		return 0, nil
+	}
+
+	list, err := Store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range list {
+		link := types.Link{Url: item.Url, Owner: item.Owner, Tags: item.Tags}
+		if err := Search.Index(ctx, item.Shorty, link); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(list), nil
+}
+
+// IndexLink updates the index without failing the operation that changed the link
+func IndexLink(ctx context.Context, shorty string, link types.Link) {
+	if Search == nil {
+		return
+	}
+
+	if err := Search.Index(ctx, shorty, link); err != nil {
+		log.Error().Caller().Err(err).Str("shorty", shorty).Msg("failed to index link")
+	}
+}
+
+// UnindexLink is the counterpart of IndexLink for removed links
+func UnindexLink(ctx context.Context, shorty string) {
+	if Search == nil {
+		return
+	}
+
+	if err := Search.Remove(ctx, shorty); err != nil {
+		log.Error().Caller().Err(err).Str("shorty", shorty).Msg("failed to remove link from index")
+	}
+}
+
+// searchDoc is what gets indexed of a link, everything lowercased for case-insensitive matching
+type searchDoc struct {
+	Shorty string
+	Host   string
+	Path   string
+	Owner  string
+	Tags   []string
+}
+
+func newSearchDoc(shorty string, link types.Link) searchDoc {
+	doc := searchDoc{
+		Shorty: strings.ToLower(shorty),
+		Owner:  link.Owner,
+		Tags:   link.Tags,
+	}
+
+	if u, err := url.Parse(link.Url); err == nil {
+		doc.Host = strings.ToLower(u.Host)
+		doc.Path = strings.ToLower(u.EscapedPath())
+	}
+
+	return doc
+}
+
+func searchLimit(query types.SearchQuery) int {
+	if query.Limit < 1 || query.Limit > searchMaxResult {
+		return searchMaxResult
+	}
+
+	return query.Limit
+}
+
+// rediSearch keeps one hash per link under search:<shorty>, indexed with suffix tries for infix queries
+type rediSearch struct {
+	client *goredis.Client
+}
+
+func newRediSearch(ctx context.Context) (*rediSearch, error) {
+	// RediSearch only indexes DB 0, the one links are kept in, and go-redis only decodes its replies over RESP2
+	client := goredis.NewClient(&goredis.Options{
+		Addr:     net.JoinHostPort(config.Use.Redis.Host, config.Use.Redis.Port),
+		Password: config.Use.Redis.Password,
+		Protocol: 2,
+	})
+
+	indexes, err := client.FT_List(ctx).Result()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	if !slices.Contains(indexes, searchIndexName) {
+		tag := func(name string) *goredis.FieldSchema {
+			return &goredis.FieldSchema{FieldName: name, FieldType: goredis.SearchFieldTypeTag, WithSuffixtrie: true}
+		}
+
+		err := client.FTCreate(ctx, searchIndexName,
+			&goredis.FTCreateOptions{OnHash: true, Prefix: []any{searchPrefix}},
+			tag("shorty"), tag("host"), tag("path"),
+			&goredis.FieldSchema{FieldName: "owner", FieldType: goredis.SearchFieldTypeTag, CaseSensitive: true},
+			&goredis.FieldSchema{FieldName: "tags", FieldType: goredis.SearchFieldTypeTag, Separator: ",", CaseSensitive: true},
+		).Err()
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return &rediSearch{client: client}, nil
+}
+
+// indexScript writes the hash of a link and gives it the PTTL of the link, so it expires with it.
+// KEYS are the link and its hash, ARGV the hash fields and values.
+var indexScript = goredis.NewScript(`
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl == -2 then
+	redis.call("DEL", KEYS[2])
+	return 0
+end
+redis.call("HSET", KEYS[2], unpack(ARGV))
+if ttl > 0 then
+	redis.call("PEXPIRE", KEYS[2], ttl)
+else
+	redis.call("PERSIST", KEYS[2])
+end
+return 1
+`)
+
+func (s *rediSearch) Index(ctx context.Context, shorty string, link types.Link) error {
+	doc := newSearchDoc(shorty, link)
+	return indexScript.Run(ctx, s.client, []string{shorty, searchPrefix + shorty},
+		"shorty", doc.Shorty,
+		"host", doc.Host,
+		"path", doc.Path,
+		"owner", doc.Owner,
+		"tags", strings.Join(doc.Tags, ","),
+	).Err()
+}
+
+func (s *rediSearch) Remove(ctx context.Context, shorty string) error {
+	return s.client.Del(ctx, searchPrefix+shorty).Err()
+}
+
+// rediSearchMinInfix is the shortest term RediSearch accepts in an infix query (its MINPREFIX)
+const rediSearchMinInfix = 2
+
+// rediSearchQuery turns a query into RediSearch syntax. Terms too short for an infix query only
+// match a whole shorty, host or path, RediSearch would reject them otherwise.
+func rediSearchQuery(query types.SearchQuery) string {
+	var clauses []string
+	if q := strings.ToLower(query.Q); q != "" {
+		term := escapeTag(q)
+		if utf8.RuneCountInString(q) >= rediSearchMinInfix {
+			term = "*" + term + "*"
+		}
+		clauses = append(clauses, fmt.Sprintf("(@shorty:{%[1]s} | @host:{%[1]s} | @path:{%[1]s})", term))
+	}
+
+	if query.Owner != "" {
+		clauses = append(clauses, fmt.Sprintf("@owner:{%s}", escapeTag(query.Owner)))
+	}
+
+	for _, tag := range query.Tags {
+		clauses = append(clauses, fmt.Sprintf("@tags:{%s}", escapeTag(tag)))
+	}
+
+	if len(clauses) == 0 {
+		return "*"
+	}
+
+	return strings.Join(clauses, " ")
+}
+
+func (s *rediSearch) Search(ctx context.Context, query types.SearchQuery) ([]string, error) {
+	res, err := s.client.FTSearchWithArgs(ctx, searchIndexName, rediSearchQuery(query), &goredis.FTSearchOptions{
+		NoContent:      true,
+		Limit:          searchLimit(query),
+		DialectVersion: 2,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	shorties := make([]string, 0, len(res.Docs))
+	for _, doc := range res.Docs {
+		shorties = append(shorties, strings.TrimPrefix(doc.ID, searchPrefix))
+	}
+
+	return shorties, nil
+}
+
+func (s *rediSearch) Close() {
+	if err := s.client.Close(); err != nil {
+		log.Error().Caller().Err(err).Send()
+	}
+}
+
+// escapeTag escapes everything RediSearch treats as syntax inside a tag query
+func escapeTag(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(",.<>{}[]\"':;!@#$%^&*()-+=~|/\\ ", r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// memoryPruneInterval is how often the in-process index drops links that expired
+const memoryPruneInterval = time.Minute
+
+// memorySearch is an in-process inverted index of trigrams, rebuilt on every start.
+// It only sees changes made by this instance.
+type memorySearch struct {
+	mu       sync.RWMutex
+	docs     map[string]searchDoc
+	expires  map[string]time.Time // links that never expire have no entry
+	trigrams map[string]map[string]struct{}
+	done     chan struct{}
+}
+
+func newMemorySearch() *memorySearch {
+	s := &memorySearch{
+		docs:     make(map[string]searchDoc),
+		expires:  make(map[string]time.Time),
+		trigrams: make(map[string]map[string]struct{}),
+		done:     make(chan struct{}),
+	}
+
+	ticker := time.NewTicker(memoryPruneInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.prune(time.Now())
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+// prune drops the links that expired by now, the store doesn't tell us when they go
+func (s *memorySearch) prune(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for shorty, expires := range s.expires {
+		if !now.Before(expires) {
+			s.remove(shorty)
+		}
+	}
+}
+
+func trigramsOf(doc searchDoc) map[string]struct{} {
+	grams := make(map[string]struct{})
+	for _, field := range []string{doc.Shorty, doc.Host, doc.Path} {
+		for i := 0; i+3 <= len(field); i++ {
+			grams[field[i:i+3]] = struct{}{}
+		}
+	}
+
+	return grams
+}
+
+func (s *memorySearch) Index(ctx context.Context, shorty string, link types.Link) error {
+	// Asked before locking, the store may be a round trip away
+	ttl, err := Store.TTL(ctx, shorty)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(shorty)
+
+	doc := newSearchDoc(shorty, link)
+	s.docs[shorty] = doc
+	if err == nil && ttl > 0 {
+		s.expires[shorty] = time.Now().Add(ttl)
+	}
+	for gram := range trigramsOf(doc) {
+		if s.trigrams[gram] == nil {
+			s.trigrams[gram] = make(map[string]struct{})
+		}
+		s.trigrams[gram][shorty] = struct{}{}
+	}
+
+	return nil
+}
+
+func (s *memorySearch) Remove(ctx context.Context, shorty string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(shorty)
+	return nil
+}
+
+func (s *memorySearch) remove(shorty string) {
+	doc, ok := s.docs[shorty]
+	if !ok {
+		return
+	}
+
+	for gram := range trigramsOf(doc) {
+		delete(s.trigrams[gram], shorty)
+		if len(s.trigrams[gram]) == 0 {
+			delete(s.trigrams, gram)
+		}
+	}
+
+	delete(s.docs, shorty)
+	delete(s.expires, shorty)
+}
+
+func (s *memorySearch) Search(ctx context.Context, query types.SearchQuery) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	q := strings.ToLower(query.Q)
+
+	// Narrow down to the smallest trigram posting list, queries too short for trigrams scan every doc
+	var candidates map[string]struct{}
+	for i := 0; i+3 <= len(q); i++ {
+		posting := s.trigrams[q[i:i+3]]
+		if candidates == nil || len(posting) < len(candidates) {
+			candidates = posting
+		}
+	}
+
+	if len(q) < 3 {
+		candidates = make(map[string]struct{}, len(s.docs))
+		for shorty := range s.docs {
+			candidates[shorty] = struct{}{}
+		}
+	}
+
+	shorties := make([]string, 0)
+	for shorty := range candidates {
+		doc := s.docs[shorty]
+		if q != "" && !strings.Contains(doc.Shorty, q) && !strings.Contains(doc.Host, q) && !strings.Contains(doc.Path, q) {
+			continue
+		}
+
+		if query.Owner != "" && doc.Owner != query.Owner {
+			continue
+		}
+
+		if !hasAllTags(doc.Tags, query.Tags) {
+			continue
+		}
+
+		shorties = append(shorties, shorty)
+	}
+
+	slices.Sort(shorties)
+	return shorties[:min(len(shorties), searchLimit(query))], nil
+}
+
+func (s *memorySearch) Close() {
+	close(s.done)
+}
+
+func hasAllTags(have, want []string) bool {
+	for _, tag := range want {
+		if !slices.Contains(have, tag) {
+			return false
+		}
+	}
+
+	return true
+}
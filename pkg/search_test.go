@@ -0,0 +1,32 @@
+package pkg
+
+import (
+	"testing"
+
+	"shorty/types"
+)
+
+func TestRediSearchQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query types.SearchQuery
+		want  string
+	}{
+		{"everything", types.SearchQuery{}, "*"},
+		{"infix", types.SearchQuery{Q: "Docs"}, "(@shorty:{*docs*} | @host:{*docs*} | @path:{*docs*})"},
+		{"shortest infix", types.SearchQuery{Q: "ab"}, "(@shorty:{*ab*} | @host:{*ab*} | @path:{*ab*})"},
+		{"single character is exact", types.SearchQuery{Q: "x"}, "(@shorty:{x} | @host:{x} | @path:{x})"},
+		{"single rune is exact", types.SearchQuery{Q: "é"}, "(@shorty:{é} | @host:{é} | @path:{é})"},
+		{"single escaped character is exact", types.SearchQuery{Q: "."}, `(@shorty:{\.} | @host:{\.} | @path:{\.})`},
+		{"escaped", types.SearchQuery{Q: "a.b/c"}, `(@shorty:{*a\.b\/c*} | @host:{*a\.b\/c*} | @path:{*a\.b\/c*})`},
+		{"owner and tags", types.SearchQuery{Owner: "alice", Tags: []string{"a-b", "c"}}, `@owner:{alice} @tags:{a\-b} @tags:{c}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rediSearchQuery(tt.query); got != tt.want {
+				t.Errorf("rediSearchQuery(%+v) = %s, want %s", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"shorty/config"
+	"shorty/types"
+)
+
+// LinkStore is the storage backend holding every shorty link
+type LinkStore interface {
+	Get(ctx context.Context, key string) (types.Link, error)
+	Set(ctx context.Context, key string, link types.Link, ttl time.Duration, checkFirst ...bool) error
+	SetWithS3Credentials(ctx context.Context, key string, link types.Link, s3Creds types.S3Credentials, ttl time.Duration, checkFirst ...bool) error
+	GetS3Credentials(ctx context.Context, key string) (types.S3Credentials, error)
+	DelS3Credentials(ctx context.Context, key string) error
+	Del(ctx context.Context, key string) error
+	SetMany(ctx context.Context, entries []Entry) []error // creates only, a taken key fails with ErrAlreadyExists
+	DelMany(ctx context.Context, keys []string) error
+	List(ctx context.Context) ([]types.Shorten, error)
+	Each(ctx context.Context, fn func(types.Shorten) bool) error // reads the links in batches, fn returns false to stop
+	Rename(ctx context.Context, oldKey, newKey string) error
+	Update(ctx context.Context, key string, link types.Link, ttl time.Duration, rev *types.Revision) error // ttl 0 keeps the current one
+	History(ctx context.Context, key string) ([]types.Revision, error)
+	TagCounts(ctx context.Context) (map[string]int64, error)
+	Tagged(ctx context.Context, tag string) ([]string, error)
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Migrate(ctx context.Context) (int, error)
+	NextSequence(ctx context.Context) (uint64, error)
+	Consume(ctx context.Context, key string) (int64, error)
+	SetHealth(ctx context.Context, key string, health types.Health) error
+	StartCleanupScheduler()
+	Close()
+}
+
+var Store LinkStore
+
+// Entry is one link of a batch create
+type Entry struct {
+	Key  string
+	Link types.Link
+	TTL  time.Duration
+}
+
+var ErrAlreadyExists = errors.New("already exists")
+
+// ErrNoClicksLeft is returned by Consume when it removed a limited link that had lost its counter
+var ErrNoClicksLeft = errors.New("no clicks left")
+
+// NoExpiry is passed as ttl for links that are kept until deleted
+const NoExpiry time.Duration = -1
+
+// expiry resolves the ttl a new link is stored with, 0 picks the configured default.
+// The result is 0 for links that never expire.
+func expiry(ttl time.Duration) time.Duration {
+	if ttl == 0 {
+		ttl = config.Use.TTL.Default
+	}
+
+	return max(ttl, 0)
+}
+
+// expiresAt turns a ttl into the time it runs out at, zero for links that never expire
+func expiresAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(ttl).UTC()
+}
+
+// NewLinkStore opens the backend selected by store.driver
+func NewLinkStore() (LinkStore, error) {
+	switch config.Use.Store.Driver {
+	case "", "redis":
+		return NewRedis()
+	case "bolt":
+		return NewBolt(config.Use.Store.Path)
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", config.Use.Store.Driver)
+	}
+}
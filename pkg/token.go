@@ -0,0 +1,158 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"shorty/types"
+	"shorty/utils"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"github.com/zeebo/blake3"
+)
+
+const (
+	tokenPrefix     = "token:"
+	tokenSecretTag  = "shorty"
+	lastUsedRefresh = time.Minute
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// tokenRecord is what we keep in the auth DB, the secret itself is never stored
+type tokenRecord struct {
+	types.Token
+	Hash string `json:"hash"`
+}
+
+// CreateToken stores a new token and returns it with its raw value, formatted as shorty_<id>_<secret>
+func (r *redis) CreateToken(ctx context.Context, token types.Token) (types.Token, string, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return token, "", err
+	}
+
+	secret, err := randomHex(24)
+	if err != nil {
+		return token, "", err
+	}
+
+	token.ID = id
+	token.CreatedAt = time.Now().UTC()
+
+	record := tokenRecord{Token: token, Hash: hashSecret(secret)}
+	if err := r.client.SetNX(ctx, tokenPrefix+id, utils.ToJSON(record), 0).Err(); err != nil {
+		return token, "", err
+	}
+
+	return token, fmt.Sprintf("%s_%s_%s", tokenSecretTag, id, secret), nil
+}
+
+// VerifyToken checks a raw token and bumps its last-used timestamp
+func (r *redis) VerifyToken(ctx context.Context, raw string) (types.Token, error) {
+	parts := strings.Split(raw, "_")
+	if len(parts) != 3 || parts[0] != tokenSecretTag {
+		return types.Token{}, ErrInvalidToken
+	}
+
+	record, err := r.getToken(ctx, parts[1])
+	if err != nil {
+		return types.Token{}, ErrInvalidToken
+	}
+
+	if subtle.ConstantTimeCompare([]byte(record.Hash), []byte(hashSecret(parts[2]))) != 1 {
+		return types.Token{}, ErrInvalidToken
+	}
+
+	now := time.Now().UTC()
+	if !record.RevokedAt.IsZero() {
+		return types.Token{}, fmt.Errorf("token %s is revoked", record.Name)
+	}
+
+	if !record.ExpiresAt.IsZero() && now.After(record.ExpiresAt) {
+		return types.Token{}, fmt.Errorf("token %s is expired", record.Name)
+	}
+
+	// Don't write on every request, a minute of precision is plenty
+	if now.Sub(record.LastUsedAt) > lastUsedRefresh {
+		record.LastUsedAt = now
+		if err := r.client.Set(ctx, tokenPrefix+record.ID, utils.ToJSON(record), goredis.KeepTTL).Err(); err != nil {
+			log.Warn().Err(err).Str("token", record.ID).Msg("failed to update token last used")
+		}
+	}
+
+	return record.Token, nil
+}
+
+func (r *redis) GetToken(ctx context.Context, id string) (types.Token, error) {
+	record, err := r.getToken(ctx, id)
+	return record.Token, err
+}
+
+func (r *redis) getToken(ctx context.Context, id string) (tokenRecord, error) {
+	var record tokenRecord
+
+	data, err := r.client.Get(ctx, tokenPrefix+id).Bytes()
+	if err == goredis.Nil {
+		return record, fmt.Errorf("not found token %s", id)
+	}
+
+	if err != nil {
+		return record, err
+	}
+
+	err = utils.FromJSON(data, &record)
+	return record, err
+}
+
+func (r *redis) ListTokens(ctx context.Context) (tokens []types.Token, err error) {
+	iter := r.client.Scan(ctx, 0, tokenPrefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		record, err := r.getToken(ctx, strings.TrimPrefix(iter.Val(), tokenPrefix))
+		if err != nil {
+			continue
+		}
+
+		tokens = append(tokens, record.Token)
+	}
+
+	err = iter.Err()
+
+	return
+}
+
+// RevokeToken keeps the record so revoked tokens still show up in listings
+func (r *redis) RevokeToken(ctx context.Context, id string) error {
+	record, err := r.getToken(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !record.RevokedAt.IsZero() {
+		return nil
+	}
+
+	record.RevokedAt = time.Now().UTC()
+	return r.client.Set(ctx, tokenPrefix+id, utils.ToJSON(record), goredis.KeepTTL).Err()
+}
+
+func hashSecret(secret string) string {
+	sum := blake3.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
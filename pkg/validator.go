@@ -0,0 +1,225 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"shorty/config"
+	"shorty/types"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Reasons a destination is rejected with
+const (
+	ReasonInvalid     = "invalid_url"
+	ReasonScheme      = "scheme_not_allowed"
+	ReasonBlocked     = "blocked_address"
+	ReasonBlocklisted = "blocklisted"
+	ReasonUnreachable = "unreachable"
+	ReasonTimeout     = "timeout"
+	ReasonStatus      = "bad_status"
+	ReasonRedirects   = "too_many_redirects"
+)
+
+// URLError explains why a destination was rejected, Url is the hop that failed which
+// may be a redirect target of the original one
+type URLError struct {
+	Reason string `json:"reason"`
+	Url    string `json:"url"`
+	Status int    `json:"status,omitempty"`
+	Err    error  `json:"-"`
+}
+
+func (e *URLError) Error() string {
+	switch {
+	case e.Status != 0:
+		return fmt.Sprintf("cannot reach %s, status code: %d", e.Url, e.Status)
+	case e.Err != nil:
+		return fmt.Sprintf("%s: %s: %v", e.Reason, e.Url, e.Err)
+	default:
+		return fmt.Sprintf("%s: %s", e.Reason, e.Url)
+	}
+}
+
+func (e *URLError) Unwrap() error {
+	return e.Err
+}
+
+var errBlocked = errors.New("address is not public")
+
+// validator is shared so checks reuse connections, it dials public addresses only
+var validator = &http.Client{
+	Transport: &http.Transport{
+		Proxy: nil, // a proxy would dial on our behalf and skip the address check
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialer := net.Dialer{Timeout: config.Use.Validate.Timeout, Control: checkDial}
+			return dialer.DialContext(ctx, network, address)
+		},
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) > config.Use.Validate.MaxRedirects {
+			return &URLError{Reason: ReasonRedirects, Url: req.URL.String()}
+		}
+
+		if err := CheckScheme(req.URL.String()); err != nil {
+			return err
+		}
+
+		return CheckBlocklist(req.URL.String())
+	},
+}
+
+// CheckScheme rejects urls that don't parse or whose scheme isn't allowed, and hosts that
+// are private addresses written out literally. It doesn't touch the network.
+func CheckScheme(target string) error {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return &URLError{Reason: ReasonInvalid, Url: target, Err: err}
+	}
+
+	if !slices.Contains(config.Use.Validate.Schemes, strings.ToLower(u.Scheme)) {
+		return &URLError{Reason: ReasonScheme, Url: target}
+	}
+
+	if addr, err := netip.ParseAddr(strings.Trim(u.Hostname(), "[]")); err == nil && !publicAddr(addr) {
+		return &URLError{Reason: ReasonBlocked, Url: target, Err: errBlocked}
+	}
+
+	// Any name under localhost resolves to loopback (RFC 6761), with or without the root dot
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if (host == "localhost" || strings.HasSuffix(host, ".localhost")) && !config.Use.Validate.AllowPrivate {
+		return &URLError{Reason: ReasonBlocked, Url: target, Err: errBlocked}
+	}
+
+	return nil
+}
+
+// ValidateAsync probes target in the background once its link is stored, so creating a link
+// never waits for the destination. The outcome is kept as the link's health, a destination that
+// doesn't answer or redirects somewhere it may not shows up as broken.
+func ValidateAsync(shorty, target string) {
+	if !config.Use.Validate.Enable {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), config.Use.Validate.Timeout)
+		defer cancel()
+
+		health := checkHealth(ctx, target)
+		if health.State() == types.HealthBroken {
+			log.Info().Str("shorty", shorty).Str("url", target).Str("error", health.Error).Int("status", health.Status).Msg("destination failed validation")
+		}
+
+		if err := Store.SetHealth(context.Background(), shorty, health); err != nil {
+			log.Debug().Err(err).Str("shorty", shorty).Msg("failed to store validation result")
+		}
+	}()
+}
+
+// probe asks for the headers of target, servers that refuse HEAD are asked for their first byte instead
+func probe(ctx context.Context, target string) (*http.Response, error) {
+	res, err := request(ctx, http.MethodHead, target)
+	if err == nil && (res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented) {
+		res, err = request(ctx, http.MethodGet, target)
+	}
+
+	return res, err
+}
+
+func request(ctx context.Context, method, target string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s link checker", config.AppName, config.AppVersion))
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+
+	res, err := validator.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1024))
+	res.Body.Close()
+
+	return res, nil
+}
+
+// urlError turns a failed request into the reason it failed for
+func urlError(target string, err error) error {
+	var ue *URLError
+	if errors.As(err, &ue) {
+		return ue
+	}
+
+	var re *url.Error
+	if errors.As(err, &re) {
+		target = re.URL
+	}
+
+	var ne net.Error
+	switch {
+	case errors.Is(err, errBlocked):
+		return &URLError{Reason: ReasonBlocked, Url: target, Err: errBlocked}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return &URLError{Reason: ReasonTimeout, Url: target, Err: err}
+	default:
+		return &URLError{Reason: ReasonUnreachable, Url: target, Err: err}
+	}
+}
+
+// checkDial runs on the resolved address, so names that point inside can't slip through
+func checkDial(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+
+	if !publicAddr(addrPort.Addr()) {
+		return errBlocked
+	}
+
+	return nil
+}
+
+var (
+	// cgnat is shared address space (RFC 6598), not reachable from the internet either
+	cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+	// nat64 is the well-known NAT64 prefix (RFC 6052), a gateway translates it to the IPv4
+	// address in its last four bytes
+	nat64 = netip.MustParsePrefix("64:ff9b::/96")
+)
+
+func publicAddr(addr netip.Addr) bool {
+	if config.Use.Validate.AllowPrivate {
+		return true
+	}
+
+	if nat64.Contains(addr) {
+		addr = netip.AddrFrom4([4]byte(addr.AsSlice()[12:]))
+	}
+
+	addr = addr.Unmap()
+	return !addr.IsLoopback() && !addr.IsPrivate() && !addr.IsLinkLocalUnicast() && !addr.IsLinkLocalMulticast() &&
+		!addr.IsUnspecified() && !addr.IsMulticast() && !cgnat.Contains(addr)
+}
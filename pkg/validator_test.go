@@ -0,0 +1,155 @@
+package pkg
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"shorty/config"
+)
+
+func withValidate(t *testing.T, allowPrivate bool) {
+	t.Helper()
+
+	old := config.Use.Validate
+	t.Cleanup(func() { config.Use.Validate = old })
+
+	config.Use.Validate.Schemes = []string{"http", "https"}
+	config.Use.Validate.AllowPrivate = allowPrivate
+}
+
+func TestPublicAddr(t *testing.T) {
+	withValidate(t, false)
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"100.63.255.255", true},
+		{"100.128.0.0", true},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:100.64.0.1", false},
+		{"::ffff:93.184.216.34", true},
+		{"64:ff9b::7f00:1", false},
+		{"64:ff9b::a00:1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"64:ff9b::6440:1", false},
+		{"64:ff9b::5db8:d822", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := publicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("publicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublicAddrAllowPrivate(t *testing.T) {
+	withValidate(t, true)
+
+	for _, addr := range []string{"127.0.0.1", "10.0.0.1", "100.64.0.1", "::ffff:127.0.0.1"} {
+		if !publicAddr(netip.MustParseAddr(addr)) {
+			t.Errorf("publicAddr(%s) = false with allow_private", addr)
+		}
+	}
+}
+
+func TestCheckScheme(t *testing.T) {
+	withValidate(t, false)
+
+	tests := []struct {
+		target string
+		reason string // empty when allowed
+	}{
+		{"https://example.com/path", ""},
+		{"HTTP://example.com", ""},
+		{"https://93.184.216.34/", ""},
+		{"ftp://example.com/file", ReasonScheme},
+		{"javascript:alert(1)", ReasonInvalid},
+		{"example.com", ReasonInvalid},
+		{"https://", ReasonInvalid},
+		{"http://localhost:8080", ReasonBlocked},
+		{"http://LOCALHOST/", ReasonBlocked},
+		{"http://localhost./", ReasonBlocked},
+		{"http://api.localhost/", ReasonBlocked},
+		{"http://127.0.0.1/", ReasonBlocked},
+		{"http://[::1]/", ReasonBlocked},
+		{"http://[::ffff:127.0.0.1]/", ReasonBlocked},
+		{"http://[::ffff:169.254.169.254]/latest/meta-data", ReasonBlocked},
+		{"http://100.64.1.1/", ReasonBlocked},
+		{"http://10.0.0.1:9000/", ReasonBlocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			err := CheckScheme(tt.target)
+			if tt.reason == "" {
+				if err != nil {
+					t.Fatalf("CheckScheme(%q) = %v, want nil", tt.target, err)
+				}
+				return
+			}
+
+			var ue *URLError
+			if !errors.As(err, &ue) {
+				t.Fatalf("CheckScheme(%q) = %v, want a URLError", tt.target, err)
+			}
+
+			if ue.Reason != tt.reason {
+				t.Errorf("CheckScheme(%q) reason = %s, want %s", tt.target, ue.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestCheckDial(t *testing.T) {
+	withValidate(t, false)
+
+	tests := []struct {
+		address string
+		blocked bool
+	}{
+		{"93.184.216.34:443", false},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:80", false},
+		{"127.0.0.1:80", true},
+		{"[::1]:443", true},
+		{"[::ffff:127.0.0.1]:80", true},
+		{"[::ffff:192.168.0.1]:80", true},
+		{"100.100.100.200:80", true},
+		{"[64:ff9b::a9fe:a9fe]:80", true},
+		{"169.254.169.254:80", true},
+		{"0.0.0.0:80", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := checkDial("tcp", tt.address, nil)
+			if tt.blocked != errors.Is(err, errBlocked) {
+				t.Errorf("checkDial(%s) = %v, blocked want %v", tt.address, err, tt.blocked)
+			}
+		})
+	}
+
+	if err := checkDial("tcp", "not an address", nil); err == nil || errors.Is(err, errBlocked) {
+		t.Errorf("checkDial of a malformed address = %v, want a parse error", err)
+	}
+}
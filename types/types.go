@@ -1,6 +1,10 @@
 package types
 
-import "time"
+import (
+	"slices"
+	"strings"
+	"time"
+)
 
 type Response struct {
 	Error   bool   `json:"error"`
@@ -14,9 +18,450 @@ type S3Credentials struct {
 }
 
 type Shorten struct {
-	Url     string        `json:"url"`
-	File    string        `json:"file,omitempty"`
-	Shorty  string        `json:"shorty,omitempty"`
-	Expired time.Duration `json:"expired,omitempty"`
-	S3Key   S3Credentials `json:"s3_credentials,omitzero"`
+	Url        string        `json:"url"`
+	File       string        `json:"file,omitempty"`
+	Shorty     string        `json:"shorty,omitempty"`
+	Expired    time.Duration `json:"expired,omitempty"` // only read on creation, see ExpiresAt
+	ExpiresAt  time.Time     `json:"expires_at,omitzero"`
+	Permanent  bool          `json:"permanent,omitempty"` // never expires
+	S3Key      S3Credentials `json:"s3_credentials,omitzero"`
+	HasS3Key   bool          `json:"has_s3_credentials,omitempty"` // set when listing, the credentials themselves are never sent
+	Generator  string        `json:"generator,omitempty"`          // only read on creation
+	Length     int           `json:"length,omitempty"`             // only read on creation
+	SkipCheck  bool          `json:"skip_check,omitempty"`         // only read on creation, don't probe the destination
+	Password   string        `json:"password,omitempty"`           // only read on creation
+	Protected  bool          `json:"protected,omitempty"`
+	MaxClicks  int64         `json:"max_clicks,omitempty"`
+	ClicksLeft int64         `json:"clicks_left,omitempty"`
+	NotBefore  time.Time     `json:"not_before,omitzero"`
+	NotAfter   time.Time     `json:"not_after,omitzero"`
+	State      string        `json:"state,omitempty"`
+	Redirect   string        `json:"redirect,omitempty"`
+	Kind       string        `json:"kind,omitempty"`
+	Owner      string        `json:"owner,omitempty"`
+	Tags       []string      `json:"tags,omitempty"`
+	Notes      string        `json:"notes,omitempty"`
+	Health     *Health       `json:"health,omitempty"`
+	CreatedAt  time.Time     `json:"created_at,omitzero"`
+	UpdatedAt  time.Time     `json:"updated_at,omitzero"`
+}
+
+const (
+	HealthOK      = "ok"
+	HealthBroken  = "broken"
+	HealthUnknown = "unknown" // not checked yet
+)
+
+// Health is the outcome of the last periodic check of a link destination
+type Health struct {
+	Status    int       `json:"status,omitempty"` // 0 when no response came back
+	LatencyMs int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+func (h *Health) State() string {
+	switch {
+	case h == nil || h.CheckedAt.IsZero():
+		return HealthUnknown
+	case h.Error != "" || BrokenStatus(h.Status):
+		return HealthBroken
+	default:
+		return HealthOK
+	}
+}
+
+// BrokenStatus tells whether a destination answering with code is considered dead
+func BrokenStatus(code int) bool {
+	return code == 404 || code == 410 || code >= 500
+}
+
+const (
+	LinkVersion = 1
+
+	KindURL  = "url"
+	KindFile = "file"
+
+	StatePending = "pending"
+	StateActive  = "active"
+	StateEnded   = "ended"
+
+	RedirectMoved     = "301"
+	RedirectFound     = "302"
+	RedirectTemporary = "307"
+	RedirectPermanent = "308"
+	RedirectRefresh   = "refresh" // interstitial page with a meta refresh
+)
+
+var Redirects = []string{RedirectMoved, RedirectFound, RedirectTemporary, RedirectPermanent, RedirectRefresh}
+
+// Link is the record stored under every shorty key
+type Link struct {
+	Version   int           `json:"v"`
+	Url       string        `json:"url"`
+	Kind      string        `json:"kind"`
+	Object    string        `json:"object,omitempty"`
+	Owner     string        `json:"owner,omitempty"`
+	Tags      []string      `json:"tags,omitempty"`
+	Notes     string        `json:"notes,omitempty"`
+	TTL       time.Duration `json:"ttl,omitempty"`
+	ExpiresAt time.Time     `json:"expires_at,omitzero"`     // absolute expiry, so it doesn't move with the time it is read at
+	Password  string        `json:"password_hash,omitempty"` // bcrypt hash, empty when unprotected
+	MaxClicks int64         `json:"max_clicks,omitempty"`    // the link is deleted after this many redirects
+	NotBefore time.Time     `json:"not_before,omitzero"`
+	NotAfter  time.Time     `json:"not_after,omitzero"`
+	Redirect  string        `json:"redirect,omitempty"` // one of Redirects, empty picks a default per request
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// Shorten converts a stored record into its API representation, ttl is what's left of it (-1 never expires).
+// Records written before ExpiresAt was stored get theirs from ttl.
+func (l Link) Shorten(shorty string, ttl time.Duration) Shorten {
+	var expiresAt time.Time
+	switch {
+	case ttl < 0:
+	case !l.ExpiresAt.IsZero():
+		expiresAt = l.ExpiresAt.UTC().Truncate(time.Second)
+	default:
+		expiresAt = time.Now().Add(ttl).UTC().Truncate(time.Second)
+	}
+
+	return Shorten{
+		Url:       l.Url,
+		File:      l.Object,
+		Shorty:    shorty,
+		ExpiresAt: expiresAt,
+		Permanent: ttl < 0,
+		Kind:      l.Kind,
+		Owner:     l.Owner,
+		Tags:      l.Tags,
+		Notes:     l.Notes,
+		Protected: l.Password != "",
+		MaxClicks: l.MaxClicks,
+		NotBefore: l.NotBefore,
+		NotAfter:  l.NotAfter,
+		State:     l.State(time.Now()),
+		Redirect:  l.Redirect,
+		CreatedAt: l.CreatedAt,
+		UpdatedAt: l.UpdatedAt,
+	}
+}
+
+// State tells whether the link redirects at now according to its activation window
+func (l Link) State(now time.Time) string {
+	switch {
+	case !l.NotBefore.IsZero() && now.Before(l.NotBefore):
+		return StatePending
+	case !l.NotAfter.IsZero() && !now.Before(l.NotAfter):
+		return StateEnded
+	default:
+		return StateActive
+	}
+}
+
+// LinkPatch holds what PATCH may change, nil fields are left as they are
+type LinkPatch struct {
+	Shorty    string         `json:"shorty,omitempty"` // renames the link
+	Url       *string        `json:"url,omitempty"`
+	Expired   *time.Duration `json:"expired,omitempty"`
+	Tags      *[]string      `json:"tags,omitempty"`
+	Notes     *string        `json:"notes,omitempty"`
+	Redirect  *string        `json:"redirect,omitempty"`
+	NotBefore *time.Time     `json:"not_before,omitempty"`
+	NotAfter  *time.Time     `json:"not_after,omitempty"`
+	SkipCheck bool           `json:"skip_check,omitempty"` // don't probe a new destination
+}
+
+// Revision is a previous destination of a link, newest first in history
+type Revision struct {
+	Url       string    `json:"url"`
+	ChangedAt time.Time `json:"changed_at"`
+	ChangedBy string    `json:"changed_by,omitempty"`
+}
+
+// TTLRequest changes how long a link lives, exactly one field is set
+type TTLRequest struct {
+	Expired   time.Duration `json:"expired,omitempty"` // from now
+	ExpiresAt time.Time     `json:"expires_at,omitzero"`
+	Permanent bool          `json:"permanent,omitempty"`
+}
+
+// LinkFilter narrows /v1/list, the expiry window only matches links that expire
+type LinkFilter struct {
+	Prefix        string
+	Owner         string
+	Kind          string
+	Tag           string
+	ExpiresAfter  time.Time
+	ExpiresBefore time.Time
+	Health        string // ok, broken or unknown
+}
+
+// Match reports whether a link passes every filter that is set
+func (f LinkFilter) Match(s Shorten) bool {
+	expiryWindow := !f.ExpiresAfter.IsZero() || !f.ExpiresBefore.IsZero()
+
+	switch {
+	case f.Prefix != "" && !strings.HasPrefix(s.Shorty, f.Prefix):
+		return false
+	case f.Owner != "" && s.Owner != f.Owner:
+		return false
+	case f.Kind != "" && s.Kind != f.Kind:
+		return false
+	case f.Tag != "" && !slices.Contains(s.Tags, f.Tag):
+		return false
+	case expiryWindow && s.ExpiresAt.IsZero():
+		return false
+	case !f.ExpiresAfter.IsZero() && s.ExpiresAt.Before(f.ExpiresAfter):
+		return false
+	case !f.ExpiresBefore.IsZero() && s.ExpiresAt.After(f.ExpiresBefore):
+		return false
+	case f.Health != "" && s.Health.State() != f.Health:
+		return false
+	default:
+		return true
+	}
+}
+
+// ExportRecord is one link in /v1/export and /v1/import, secrets are only flagged
+type ExportRecord struct {
+	Shorty         string    `json:"shorty"`
+	Url            string    `json:"url"`
+	Kind           string    `json:"kind,omitempty"`
+	Object         string    `json:"object,omitempty"`
+	Owner          string    `json:"owner,omitempty"`
+	Tags           []string  `json:"tags,omitempty"`
+	Notes          string    `json:"notes,omitempty"`
+	Redirect       string    `json:"redirect,omitempty"`
+	MaxClicks      int64     `json:"max_clicks,omitempty"`
+	NotBefore      time.Time `json:"not_before,omitzero"`
+	NotAfter       time.Time `json:"not_after,omitzero"`
+	ExpiresAt      time.Time `json:"expires_at,omitzero"`
+	Permanent      bool      `json:"permanent,omitempty"`
+	Protected      bool      `json:"protected,omitempty"`
+	HasCredentials bool      `json:"has_credentials,omitempty"`
+	CreatedAt      time.Time `json:"created_at,omitzero"`
+}
+
+const (
+	ImportCreated     = "created"
+	ImportOverwritten = "overwritten"
+	ImportRenamed     = "renamed"
+	ImportSkipped     = "skipped"
+	ImportFailed      = "failed"
+)
+
+type ImportResult struct {
+	Line   int    `json:"line"`
+	Shorty string `json:"shorty,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun  bool           `json:"dry_run"`
+	Created int            `json:"created"`
+	Skipped int            `json:"skipped"`
+	Failed  int            `json:"failed"`
+	Rows    []ImportResult `json:"rows"`
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+// BulkTagRequest adds and removes tags on many links at once
+type BulkTagRequest struct {
+	Shorties []string `json:"shorties"`
+	Add      []string `json:"add,omitempty"`
+	Remove   []string `json:"remove,omitempty"`
+}
+
+// BulkResult is the outcome of one item of a bulk operation
+type BulkResult struct {
+	Shorty string `json:"shorty"`
+	Url    string `json:"url,omitempty"` // short url of a created link
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Reason string `json:"reason,omitempty"` // why a destination was rejected
+}
+
+// BlocklistEntry is a domain, url or /regex/ line of the local blocklist
+type BlocklistEntry struct {
+	Entry string `json:"entry"`
+}
+
+// BlocklistInfo describes the loaded blocklist, Entries are the ones managed through the API
+type BlocklistInfo struct {
+	Files    []string  `json:"files"`
+	Entries  []string  `json:"entries"`
+	Domains  int       `json:"domains"`
+	Urls     int       `json:"urls"`
+	Patterns int       `json:"patterns"`
+	LoadedAt time.Time `json:"loaded_at,omitzero"`
+}
+
+// BlocklistMatch tells whether a url is blocked and by which entry
+type BlocklistMatch struct {
+	Url     string `json:"url"`
+	Blocked bool   `json:"blocked"`
+	Entry   string `json:"entry,omitempty"`
+}
+
+type SearchQuery struct {
+	Q     string // substring of shorty, destination host or path
+	Owner string
+	Tags  []string // links must carry every tag
+	Limit int
+}
+
+type StatsBucket struct {
+	Time  time.Time `json:"time"`
+	Count int64     `json:"count"`
+}
+
+type StatsCounter struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+type Stats struct {
+	Shorty    string         `json:"shorty"`
+	Total     int64          `json:"total"`
+	Unique    int64          `json:"unique"`
+	Hourly    []StatsBucket  `json:"hourly"`
+	Daily     []StatsBucket  `json:"daily"`
+	Referrers []StatsCounter `json:"referrers"`
+	Agents    []StatsCounter `json:"agents"`
+	Countries []StatsCounter `json:"countries"`
+}
+
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+func (r Role) rank() int {
+	switch r {
+	case RoleAdmin:
+		return 3
+	case RoleEditor:
+		return 2
+	case RoleViewer:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Can reports whether r grants at least the permissions of min
+func (r Role) Can(min Role) bool {
+	return r.rank() >= min.rank()
+}
+
+// Caller identifies who made a request, set by the session check or the API key validator
+type Caller struct {
+	Name   string   `json:"name"`
+	Method string   `json:"method"`
+	Role   Role     `json:"role"`
+	Scopes []string `json:"scopes,omitempty"` // nil means unrestricted, only API tokens carry scopes
+	Groups []string `json:"-"`                // GitLab groups of a session, kept on the tokens it creates
+}
+
+func (c Caller) IsAdmin() bool {
+	return c.Role == RoleAdmin
+}
+
+func (c Caller) HasScope(scope string) bool {
+	return c.Scopes == nil || slices.Contains(c.Scopes, scope)
+}
+
+const (
+	ScopeCreate = "create"
+	ScopeDelete = "delete"
+	ScopeList   = "list"
+	ScopeUpload = "upload"
+)
+
+var Scopes = []string{ScopeCreate, ScopeDelete, ScopeList, ScopeUpload}
+
+// Token is a named API token, its secret is only returned once on creation
+type Token struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Owner      string    `json:"owner"`
+	Role       Role      `json:"role"`             // role of the creator, the token never acts above it
+	Groups     []string  `json:"groups,omitempty"` // groups of the creator, roles granted to them are resolved on use
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at,omitzero"`
+	LastUsedAt time.Time `json:"last_used_at,omitzero"`
+	RevokedAt  time.Time `json:"revoked_at,omitzero"`
+}
+
+type TokenRequest struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+const (
+	ActionCreate      = "create"
+	ActionRename      = "rename"
+	ActionDelete      = "delete"
+	ActionUpdate      = "update"
+	ActionRevert      = "revert"
+	ActionExpire      = "expire"
+	ActionTag         = "tag"
+	ActionImport      = "import"
+	ActionBlock       = "block"
+	ActionUnblock     = "unblock"
+	ActionUpload      = "upload"
+	ActionTokenCreate = "token.create"
+	ActionTokenRevoke = "token.revoke"
+)
+
+// AuditEntry records a single mutating operation
+type AuditEntry struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Method string    `json:"method"`
+	Action string    `json:"action"`
+	Shorty string    `json:"shorty,omitempty"`
+	Old    string    `json:"old,omitempty"`
+	New    string    `json:"new,omitempty"`
+	IP     string    `json:"ip,omitempty"`
+}
+
+type AuditFilter struct {
+	Actor  string
+	Action string
+	Shorty string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// Match reports whether an entry passes every filter that is set
+func (f AuditFilter) Match(e AuditEntry) bool {
+	switch {
+	case f.Actor != "" && e.Actor != f.Actor:
+		return false
+	case f.Action != "" && e.Action != f.Action:
+		return false
+	case f.Shorty != "" && e.Shorty != f.Shorty:
+		return false
+	case !f.From.IsZero() && e.Time.Before(f.From):
+		return false
+	case !f.To.IsZero() && e.Time.After(f.To):
+		return false
+	default:
+		return true
+	}
 }
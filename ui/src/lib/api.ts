@@ -1,4 +1,5 @@
 import { API_BASE_URL } from '$lib/config';
+import type { ApiToken, AuditEntry, ShortyData } from '$lib/types';
 class ApiClient {
 	private getHeaders() {
 		return {
@@ -43,6 +44,33 @@ class ApiClient {
 			method: 'PATCH'
 		});
 	}
+
+	async listTokens(): Promise<ApiToken[]> {
+		return await this.fetchWithCredentials(`${API_BASE_URL}/tokens`);
+	}
+
+	async createToken(name: string, scopes: string[], expiresAt?: string) {
+		return await this.fetchWithCredentials(`${API_BASE_URL}/tokens`, {
+			method: 'POST',
+			body: JSON.stringify({ name, scopes, expires_at: expiresAt })
+		});
+	}
+
+	async revokeToken(id: string) {
+		await this.fetchWithCredentials(`${API_BASE_URL}/tokens/${id}`, {
+			method: 'DELETE'
+		});
+	}
+
+	async searchShorty(q: string): Promise<ShortyData[]> {
+		const params = new URLSearchParams({ q });
+		return await this.fetchWithCredentials(`${API_BASE_URL}/search?${params}`);
+	}
+
+	async listAudit(filters: Record<string, string>): Promise<AuditEntry[]> {
+		const params = new URLSearchParams(Object.entries(filters).filter(([, value]) => value !== ''));
+		return await this.fetchWithCredentials(`${API_BASE_URL}/audit?${params}`);
+	}
 }
 
 export const api = new ApiClient();
@@ -4,12 +4,14 @@ interface AuthStore {
 	isAuthenticated: boolean;
 	username: string | null;
 	s3Enabled: boolean;
+	role: 'admin' | 'editor' | 'viewer' | null;
 }
 
 const initialState: AuthStore = {
 	isAuthenticated: false,
 	username: null,
-	s3Enabled: false
+	s3Enabled: false,
+	role: null
 };
 
 function createAuthStore() {
@@ -17,17 +19,19 @@ function createAuthStore() {
 
 	return {
 		subscribe,
-		login: (username: string, s3Enabled: boolean) =>
+		login: (username: string, s3Enabled: boolean, role: AuthStore['role'] = null) =>
 			set({
 				isAuthenticated: true,
 				username,
-				s3Enabled
+				s3Enabled,
+				role
 			}),
 		logout: () =>
 			set({
 				isAuthenticated: false,
 				username: null,
-				s3Enabled: false
+				s3Enabled: false,
+				role: null
 			}),
 		updateS3Status: (status: boolean) => update((state) => ({ ...state, s3Enabled: status }))
 	};
@@ -2,7 +2,54 @@ export interface ShortyData {
 	shorty: string;
 	file: string;
 	url: string;
-	expired: string;
+	expires_at?: string;
+	permanent?: boolean;
+	kind?: 'url' | 'file';
+	owner?: string;
+	tags?: string[];
+	notes?: string;
+	health?: LinkHealth;
+	protected?: boolean;
+	has_s3_credentials?: boolean;
+	max_clicks?: number;
+	clicks_left?: number;
+	not_before?: string;
+	not_after?: string;
+	state?: 'pending' | 'active' | 'ended';
+	redirect?: '301' | '302' | '307' | '308' | 'refresh';
+	created_at?: string;
+	updated_at?: string;
+}
+
+export interface LinkHealth {
+	status?: number;
+	latency_ms: number;
+	error?: string;
+	checked_at: string;
+}
+
+export interface ApiToken {
+	id: string;
+	name: string;
+	owner: string;
+	role: string;
+	scopes: string[];
+	created_at: string;
+	expires_at?: string;
+	last_used_at?: string;
+	revoked_at?: string;
+}
+
+export interface AuditEntry {
+	id: string;
+	time: string;
+	actor: string;
+	method: string;
+	action: string;
+	shorty?: string;
+	old?: string;
+	new?: string;
+	ip?: string;
 }
 
 export type SSECallback = (data: string) => void;
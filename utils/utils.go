@@ -69,3 +69,8 @@ func FromJSON(data []byte, v any) error {
 	}
 	return nil
 }
+
+// NormalizeAlias turns a custom shorty into its URL-safe form, e.g. "Launch Día" becomes "launch-dia"
+func NormalizeAlias(alias string) string {
+	return slug.MakeLang(strings.TrimSpace(alias), "en")
+}
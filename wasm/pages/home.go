@@ -212,8 +212,12 @@ func (h *Home) copyToClipboard(url string) {
 	components.ShowToast("Success", "Copied to clipboard!", "success")
 }
 
-func (h *Home) formatExpiry(duration time.Duration) string {
-	secs := duration.Seconds()
+func (h *Home) formatExpiry(row types.ShortyData) string {
+	if row.Permanent || row.ExpiresAt.IsZero() {
+		return "never"
+	}
+
+	secs := max(time.Until(row.ExpiresAt).Seconds(), 0)
 
 	if secs < 60 {
 		return fmt.Sprintf("%ds", int(secs))
@@ -488,7 +492,7 @@ func (h *Home) renderDataTable() app.UI {
 									// Expired column
 									app.Td().
 										Class("whitespace-nowrap px-6 py-4").
-										Text(h.formatExpiry(row.Expired)),
+										Text(h.formatExpiry(row)),
 									// Actions column
 									app.Td().
 										Class("whitespace-nowrap px-6 py-4").
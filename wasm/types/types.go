@@ -12,10 +12,11 @@ var jar, _ = cookiejar.New(nil)
 var DefaultClient = &http.Client{Jar: jar}
 
 type ShortyData struct {
-	Shorty  string        `json:"shorty"`
-	File    string        `json:"file"`
-	URL     string        `json:"url"`
-	Expired time.Duration `json:"expired"`
+	Shorty    string    `json:"shorty"`
+	File      string    `json:"file"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Permanent bool      `json:"permanent"`
 }
 
 type APIResponse struct {